@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/krateoplatformops/finops-prometheus-exporter-generic/internal/helpers/kube/httpcall"
 	"github.com/krateoplatformops/finops-prometheus-exporter-generic/internal/helpers/kube/secrets"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/rest"
 
@@ -18,17 +20,33 @@ import (
 type ResolveOptions struct {
 	RESTConfig *rest.Config
 	API        *finopsdatatypes.API
-	AuthNS     string
-	Username   string
+	// AuthNS, if set, is the only namespace endpoint Secrets can be read from.
+	AuthNS string
+	// Username, if set, is impersonated while reading endpoint Secrets
+	// (e.g. system:serviceaccount:<namespace>:<name>).
+	Username string
+	// Groups are impersonated together with Username.
+	Groups []string
 }
 
 func Resolve(ctx context.Context, opts ResolveOptions) (*httpcall.Endpoint, error) {
+	if opts.RESTConfig == nil {
+		return &httpcall.Endpoint{}, fmt.Errorf("missing rest config to resolve the endpoint")
+	}
+
 	state := opts.RESTConfig.Impersonate
 	defer func() {
 		opts.RESTConfig.Impersonate = state
 	}()
 
 	opts.RESTConfig.Impersonate = rest.ImpersonationConfig{}
+	if len(opts.Username) > 0 {
+		opts.RESTConfig.Impersonate = rest.ImpersonationConfig{
+			UserName: opts.Username,
+			Groups:   opts.Groups,
+		}
+	}
+
 	res, err := endpointResolver(opts.RESTConfig, opts.AuthNS, opts.Username)
 	if err != nil {
 		return &httpcall.Endpoint{}, err
@@ -61,6 +79,29 @@ type resolver struct {
 	username string
 }
 
+// identity describes who the secret was read as, for error messages.
+func (er *resolver) identity() string {
+	if len(er.username) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (impersonating %s)", er.username)
+}
+
+// ImpersonationFromEnv returns the impersonated user, groups and auth namespace
+// configured through the IMPERSONATE_USER, IMPERSONATE_GROUPS and AUTH_NAMESPACE
+// environment variables. They are set on the exporter deployment, not in the
+// exporter config, so that a tenant cannot lift its own restrictions.
+func ImpersonationFromEnv() (username string, groups []string, authNS string) {
+	username = os.Getenv("IMPERSONATE_USER")
+	for _, g := range strings.Split(os.Getenv("IMPERSONATE_GROUPS"), ",") {
+		if g = strings.TrimSpace(g); len(g) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	authNS = os.Getenv("AUTH_NAMESPACE")
+	return username, groups, authNS
+}
+
 func (er *resolver) Do(ctx context.Context, ref *finopsdatatypes.ObjectRef) (*httpcall.Endpoint, error) {
 	var err error
 	res := &httpcall.Endpoint{}
@@ -80,15 +121,25 @@ func (er *resolver) Do(ctx context.Context, ref *finopsdatatypes.ObjectRef) (*ht
 				"server-url":                 []byte("https://kubernetes.default.svc"),
 				"token":                      tokenData,
 				"certificate-authority-data": certData,
-				"insecure":                   []byte("true"),
 			},
 		}
 		isInternal = true
 	}
 
 	if !isInternal {
-		sec, err = er.cli.Namespace(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		ns := ref.Namespace
+		if len(ns) == 0 {
+			ns = er.authNS
+		}
+		if len(er.authNS) > 0 && ns != er.authNS {
+			return res, fmt.Errorf("endpoint secret %s/%s is outside of the auth namespace %s", ns, ref.Name, er.authNS)
+		}
+
+		sec, err = er.cli.Namespace(ns).Get(ctx, ref.Name, metav1.GetOptions{})
 		if err != nil {
+			if apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err) {
+				return res, fmt.Errorf("access denied to endpoint secret %s/%s%s: %w", ns, ref.Name, er.identity(), err)
+			}
 			return res, err
 		}
 	}
@@ -135,5 +186,21 @@ func (er *resolver) Do(ctx context.Context, ref *finopsdatatypes.ObjectRef) (*ht
 		res.Insecure, _ = strconv.ParseBool(string(v))
 	}
 
+	if v, ok := sec.Data["server-name"]; ok {
+		res.ServerName = string(v)
+	}
+
+	if v, ok := sec.Data["tls-min-version"]; ok {
+		res.TLSMinVersion = string(v)
+	}
+
+	if v, ok := sec.Data["tls-cipher-suites"]; ok {
+		for _, cs := range strings.Split(string(v), ",") {
+			if cs = strings.TrimSpace(cs); len(cs) > 0 {
+				res.TLSCipherSuites = append(res.TLSCipherSuites, cs)
+			}
+		}
+	}
+
 	return res, nil
 }
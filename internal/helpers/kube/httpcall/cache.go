@@ -0,0 +1,76 @@
+package httpcall
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxCachedClients bounds the number of clients kept, one per endpoint configuration.
+const maxCachedClients = 16
+
+type cachedClient struct {
+	client   *http.Client
+	lastUsed time.Time
+}
+
+var clientCache = struct {
+	sync.Mutex
+	clients map[string]*cachedClient
+}{clients: map[string]*cachedClient{}}
+
+// CachedHTTPClientForEndpoint returns the client built for the same endpoint configuration
+// by a previous call, so that its connections are reused. A new client is only built when
+// the credentials, TLS or transport settings of the endpoint change.
+func CachedHTTPClientForEndpoint(authn *Endpoint) (*http.Client, error) {
+	key, err := endpointHash(authn)
+	if err != nil {
+		return HTTPClientForEndpoint(authn)
+	}
+
+	clientCache.Lock()
+	defer clientCache.Unlock()
+
+	if cached, ok := clientCache.clients[key]; ok {
+		cached.lastUsed = time.Now()
+		return cached.client, nil
+	}
+
+	client, err := HTTPClientForEndpoint(authn)
+	if err != nil {
+		return client, err
+	}
+
+	if len(clientCache.clients) >= maxCachedClients {
+		evictLeastRecentlyUsed()
+	}
+	clientCache.clients[key] = &cachedClient{client: client, lastUsed: time.Now()}
+
+	return client, nil
+}
+
+// endpointHash identifies the endpoint configuration without keeping its credentials in memory.
+func endpointHash(authn *Endpoint) (string, error) {
+	data, err := json.Marshal(authn)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func evictLeastRecentlyUsed() {
+	oldestKey := ""
+	for key, cached := range clientCache.clients {
+		if oldestKey == "" || cached.lastUsed.Before(clientCache.clients[oldestKey].lastUsed) {
+			oldestKey = key
+		}
+	}
+	if oldestKey != "" {
+		clientCache.clients[oldestKey].client.CloseIdleConnections()
+		delete(clientCache.clients, oldestKey)
+	}
+}
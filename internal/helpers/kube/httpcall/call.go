@@ -9,21 +9,66 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
 type Options struct {
 	API      *finopsdatatypes.API
 	Endpoint *Endpoint
-	DS       map[string]any
+	// DS is the data of the path, headers and payload templates; when nil they are sent as they are.
+	DS map[string]any
+	// Cache, if set, makes the request conditional on the validators of the cached response to it.
+	Cache *ResponseCache
+	// CacheVariant is the variant of the cached responses the request is conditional on.
+	CacheVariant string
+	// Unconditional sends the request without validators, e.g. when the cached response cannot be reused.
+	Unconditional bool
+	// OnRateLimitWait, if set, is called with the time spent waiting for the rate limiter of the endpoint.
+	OnRateLimitWait func(time.Duration)
+	// Logger logs the request and, with the debug options of the endpoint, its exchange (the global zerolog logger by default).
+	Logger *zerolog.Logger
+}
+
+type loggerContextKey struct{}
+
+// loggerFrom returns the logger of the request context, or the global zerolog logger.
+func loggerFrom(ctx context.Context) *zerolog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*zerolog.Logger); ok {
+		return logger
+	}
+	return &log.Logger
 }
 
 func Do(ctx context.Context, client *http.Client, opts Options) (*http.Response, error) {
+	path, payload, headers := opts.API.Path, opts.API.Payload, opts.API.Headers
+	if opts.DS != nil {
+		var err error
+		path, err = renderTemplate("path", path, opts.DS)
+		if err != nil {
+			return nil, err
+		}
+
+		payload, err = renderTemplate("payload", payload, opts.DS)
+		if err != nil {
+			return nil, err
+		}
+
+		headers = make([]string, len(opts.API.Headers))
+		for i, el := range opts.API.Headers {
+			headers[i], err = renderTemplate("header", el, opts.DS)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	uri := strings.TrimSuffix(opts.Endpoint.ServerURL, "/")
-	if len(opts.API.Path) > 0 {
-		uri = fmt.Sprintf("%s/%s", uri, strings.TrimPrefix(opts.API.Path, "/"))
+	if len(path) > 0 {
+		uri = fmt.Sprintf("%s/%s", uri, strings.TrimPrefix(path, "/"))
 	}
 
 	u, err := url.Parse(uri)
@@ -34,18 +79,27 @@ func Do(ctx context.Context, client *http.Client, opts Options) (*http.Response,
 	verb := opts.API.Verb
 
 	var body io.Reader
-	if len(opts.API.Payload) > 0 {
-		body = strings.NewReader(opts.API.Payload)
+	if len(payload) > 0 {
+		body = strings.NewReader(payload)
+	}
+
+	if opts.OnRateLimitWait != nil {
+		ctx = context.WithValue(ctx, rateLimitWaitContextKey{}, opts.OnRateLimitWait)
+	}
+
+	if opts.Logger != nil {
+		ctx = context.WithValue(ctx, loggerContextKey{}, opts.Logger)
 	}
 
-	log.Info().Msgf("Request URL: %s", u.String())
+	// The query can hold credentials (e.g. sig or code), they are never logged
+	loggerFrom(ctx).Info().Msgf("Request URL: %s", redactURL(u, redactFieldsFor(opts.Endpoint.DebugOptions)))
 	req, err := http.NewRequestWithContext(ctx, verb, u.String(), body)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(opts.API.Headers) > 0 {
-		for _, el := range opts.API.Headers {
+	if len(headers) > 0 {
+		for _, el := range headers {
 			idx := strings.Index(el, ":")
 			if idx <= 0 {
 				continue
@@ -54,6 +108,10 @@ func Do(ctx context.Context, client *http.Client, opts Options) (*http.Response,
 		}
 	}
 
+	if opts.Cache != nil {
+		req = opts.Cache.withConditionalHeaders(req, payload, opts.CacheVariant, opts.Unconditional)
+	}
+
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
@@ -9,14 +9,13 @@ func HTTPClientForEndpoint(authn *Endpoint) (*http.Client, error) {
 	rt, err := tlsConfigFor(authn)
 	if err != nil {
 		return &http.Client{
-			Transport: defaultTransport(),
+			Transport: defaultTransport(authn.Transport),
+			Timeout:   authn.Transport.Timeout,
 		}, err
 	}
 
 	if authn.Debug {
-		rt = &debuggingRoundTripper{
-			delegatedRoundTripper: rt,
-		}
+		rt = newDebuggingRoundTripper(rt, authn.DebugOptions)
 	}
 
 	// Set authentication wrappers
@@ -38,5 +37,7 @@ func HTTPClientForEndpoint(authn *Endpoint) (*http.Client, error) {
 		}
 	}
 
-	return &http.Client{Transport: rt}, nil
+	rt = &rateLimitRoundTripper{limiter: limiterForEndpoint(authn.ServerURL, authn.RateLimit), rt: rt}
+
+	return &http.Client{Transport: rt, Timeout: authn.Transport.Timeout}, nil
 }
@@ -0,0 +1,124 @@
+package httpcall
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxCachedResponses bounds the number of responses kept, one per endpoint and request.
+const maxCachedResponses = 256
+
+// CachedResponse is what is remembered of the last response to a request.
+type CachedResponse struct {
+	// ETag and LastModified are sent back as If-None-Match and If-Modified-Since.
+	ETag         string
+	LastModified string
+	// Hash is the content hash of the body, set by the caller.
+	Hash string
+	// Value is what the caller decoded from the body, reused when the response is not modified.
+	Value any
+	// Variant identifies what, besides the body, the value depends on, e.g. the decoding options.
+	// The validators are only sent for the same variant.
+	Variant string
+
+	lastUsed time.Time
+}
+
+// ResponseCache remembers the last response to each request, by endpoint and path, so that
+// the following requests are conditional.
+type ResponseCache struct {
+	mu        sync.Mutex
+	responses map[string]*CachedResponse
+}
+
+func NewResponseCache() *ResponseCache {
+	return &ResponseCache{responses: map[string]*CachedResponse{}}
+}
+
+type cacheKeyContextKey struct{}
+
+// Lookup returns the cached response to the request of the response.
+func (c *ResponseCache) Lookup(res *http.Response) (CachedResponse, bool) {
+	key, ok := requestCacheKey(res)
+	if !ok {
+		return CachedResponse{}, false
+	}
+	return c.get(key)
+}
+
+// Store remembers the response to its request, with the validators and value of the entry.
+func (c *ResponseCache) Store(res *http.Response, entry CachedResponse) {
+	key, ok := requestCacheKey(res)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.responses[key]; !ok && len(c.responses) >= maxCachedResponses {
+		c.evictLeastRecentlyUsed()
+	}
+	entry.lastUsed = time.Now()
+	c.responses[key] = &entry
+}
+
+func (c *ResponseCache) get(key string) (CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.responses[key]
+	if !ok {
+		return CachedResponse{}, false
+	}
+	cached.lastUsed = time.Now()
+	return *cached, true
+}
+
+func (c *ResponseCache) evictLeastRecentlyUsed() {
+	oldestKey := ""
+	for key, cached := range c.responses {
+		if oldestKey == "" || cached.lastUsed.Before(c.responses[oldestKey].lastUsed) {
+			oldestKey = key
+		}
+	}
+	delete(c.responses, oldestKey)
+}
+
+// withConditionalHeaders sets If-None-Match and If-Modified-Since from the cached response to the
+// request of the same variant, unless the API headers set them, and keeps the cache key in the request
+// context. Unconditional requests are sent without validators, even those of the API headers.
+func (c *ResponseCache) withConditionalHeaders(req *http.Request, payload, variant string, unconditional bool) *http.Request {
+	sum := sha256.Sum256([]byte(payload))
+	key := req.Method + " " + req.URL.String() + " " + hex.EncodeToString(sum[:])
+	req = req.WithContext(context.WithValue(req.Context(), cacheKeyContextKey{}, key))
+
+	if unconditional {
+		req.Header.Del("If-None-Match")
+		req.Header.Del("If-Modified-Since")
+		return req
+	}
+	cached, ok := c.get(key)
+	if !ok || cached.Variant != variant {
+		return req
+	}
+	if cached.ETag != "" && req.Header.Get("If-None-Match") == "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	if cached.LastModified != "" && req.Header.Get("If-Modified-Since") == "" {
+		req.Header.Set("If-Modified-Since", cached.LastModified)
+	}
+	return req
+}
+
+func requestCacheKey(res *http.Response) (string, bool) {
+	if res == nil || res.Request == nil {
+		return "", false
+	}
+	key, ok := res.Request.Context().Value(cacheKeyContextKey{}).(string)
+	return key, ok
+}
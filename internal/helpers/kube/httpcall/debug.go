@@ -0,0 +1,202 @@
+package httpcall
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const defaultMaxBodySize = 4096
+
+var (
+	defaultRedactHeaders = []string{
+		"Authorization",
+		"Proxy-Authorization",
+		"Cookie",
+		"Set-Cookie",
+		"X-Api-Key",
+		"Api-Key",
+		"X-Auth-Token",
+		"Ocp-Apim-Subscription-Key",
+	}
+	defaultRedactFields = []string{
+		"password",
+		"client_secret",
+		"clientSecret",
+		"access_token",
+		"refresh_token",
+		"id_token",
+		"token",
+		"secret",
+		"api_key",
+		"apiKey",
+		"sig",
+		"code",
+	}
+)
+
+const redacted = "[REDACTED]"
+
+// DebugOptions configures what the debugging round tripper logs.
+type DebugOptions struct {
+	// RedactHeaders are added to the default sensitive headers.
+	RedactHeaders []string
+	// RedactFields are added to the default sensitive json fields, form fields and query parameters.
+	RedactFields []string
+	// MaxBodySize is the number of body bytes logged, defaults to 4096.
+	MaxBodySize int
+}
+
+type debuggingRoundTripper struct {
+	delegatedRoundTripper http.RoundTripper
+	redactHeaders         map[string]bool
+	redactFields          map[string]bool
+	bodyFieldsRegex       *regexp.Regexp
+	maxBodySize           int
+}
+
+func newDebuggingRoundTripper(rt http.RoundTripper, opts DebugOptions) *debuggingRoundTripper {
+	res := &debuggingRoundTripper{
+		delegatedRoundTripper: rt,
+		redactHeaders:         map[string]bool{},
+		maxBodySize:           opts.MaxBodySize,
+	}
+	if res.maxBodySize <= 0 {
+		res.maxBodySize = defaultMaxBodySize
+	}
+
+	for _, h := range append(defaultRedactHeaders, opts.RedactHeaders...) {
+		res.redactHeaders[http.CanonicalHeaderKey(h)] = true
+	}
+
+	res.redactFields = redactFieldsFor(opts)
+	quoted := []string{}
+	for _, f := range append(defaultRedactFields, opts.RedactFields...) {
+		quoted = append(quoted, regexp.QuoteMeta(f))
+	}
+	fields := strings.Join(quoted, "|")
+	// Matches "field": "value" in json bodies, even when truncated within the value, and field=value in form bodies
+	res.bodyFieldsRegex = regexp.MustCompile(`(?i)("(?:` + fields + `)"\s*:\s*)"(?:[^"\\]|\\.)*(?:"|\\?$)|(^|[&?])((?:` + fields + `)=)[^&]*`)
+
+	return res
+}
+
+func (rt *debuggingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = cloneRequest(req)
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	logger := loggerFrom(req.Context())
+	logger.Debug().
+		Str("method", req.Method).
+		Str("url", rt.redactURL(req.URL)).
+		Interface("headers", rt.redactHeaderValues(req.Header)).
+		Str("body", rt.redactBody(reqBody)).
+		Msg("HTTP request")
+
+	resp, err := rt.delegatedRoundTripper.RoundTrip(req)
+	if err != nil {
+		logger.Debug().Err(err).Str("url", rt.redactURL(req.URL)).Msg("HTTP request failed")
+		return resp, err
+	}
+
+	// Only read what is logged, the rest of the body is left to the caller
+	head, err := io.ReadAll(io.LimitReader(resp.Body, int64(rt.maxBodySize)+1))
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+
+	logger.Debug().
+		Int("status", resp.StatusCode).
+		Str("url", rt.redactURL(req.URL)).
+		Interface("headers", rt.redactHeaderValues(resp.Header)).
+		Str("body", rt.redactBody(head)).
+		Msg("HTTP response")
+
+	return resp, nil
+}
+
+func (rt *debuggingRoundTripper) redactHeaderValues(in http.Header) http.Header {
+	out := cloneHeader(in)
+	for key := range out {
+		if rt.redactHeaders[http.CanonicalHeaderKey(key)] {
+			out[key] = []string{redacted}
+		}
+	}
+	return out
+}
+
+func (rt *debuggingRoundTripper) redactURL(u *url.URL) string {
+	return redactURL(u, rt.redactFields)
+}
+
+// redactURL removes the password of the URL and redacts the sensitive query parameters.
+func redactURL(u *url.URL, fields map[string]bool) string {
+	res := *u
+	if res.User != nil {
+		res.User = url.User(res.User.Username())
+	}
+
+	query := res.Query()
+	for key := range query {
+		if fields[strings.ToLower(key)] {
+			query.Set(key, redacted)
+		}
+	}
+	res.RawQuery = query.Encode()
+	return res.String()
+}
+
+// redactFieldsFor returns the sensitive fields of the debug options, the default ones included.
+func redactFieldsFor(opts DebugOptions) map[string]bool {
+	fields := map[string]bool{}
+	for _, f := range append(defaultRedactFields, opts.RedactFields...) {
+		fields[strings.ToLower(f)] = true
+	}
+	return fields
+}
+
+// RedactedBody reads the head of a body, with the sensitive fields redacted and truncated to the
+// maximum size of the debug options, e.g. to log the body of an error response.
+func RedactedBody(body io.Reader, opts DebugOptions) string {
+	rt := newDebuggingRoundTripper(nil, opts)
+	head, _ := io.ReadAll(io.LimitReader(body, int64(rt.maxBodySize)+1))
+	return rt.redactBody(head)
+}
+
+// redactBody redacts the sensitive fields and truncates the body to the maximum size.
+func (rt *debuggingRoundTripper) redactBody(body []byte) string {
+	truncated := false
+	if len(body) > rt.maxBodySize {
+		body = body[:rt.maxBodySize]
+		truncated = true
+	}
+
+	res := rt.bodyFieldsRegex.ReplaceAllStringFunc(string(body), func(match string) string {
+		sub := rt.bodyFieldsRegex.FindStringSubmatch(match)
+		if len(sub[1]) > 0 {
+			return sub[1] + `"` + redacted + `"`
+		}
+		return sub[2] + sub[3] + redacted
+	})
+
+	if truncated {
+		res += "...(truncated)"
+	}
+	return res
+}
@@ -0,0 +1,57 @@
+package httpcall
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactedBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		opts DebugOptions
+		want string
+	}{
+		{
+			name: "json",
+			body: `{"error":"invalid_grant","access_token":"abc","detail":"x"}`,
+			want: `{"error":"invalid_grant","access_token":"[REDACTED]","detail":"x"}`,
+		},
+		{
+			name: "escaped quotes",
+			body: `{"client_secret": "a\"b", "ok": true}`,
+			want: `{"client_secret": "[REDACTED]", "ok": true}`,
+		},
+		{
+			name: "form",
+			body: `grant_type=client_credentials&client_secret=abc&scope=x`,
+			want: `grant_type=client_credentials&client_secret=[REDACTED]&scope=x`,
+		},
+		{
+			name: "custom field",
+			body: `{"subscriptionKey":"abc"}`,
+			opts: DebugOptions{RedactFields: []string{"subscriptionKey"}},
+			want: `{"subscriptionKey":"[REDACTED]"}`,
+		},
+		{
+			name: "truncated",
+			body: `{"message":"` + strings.Repeat("x", 20) + `"}`,
+			opts: DebugOptions{MaxBodySize: 16},
+			want: `{"message":"xxxx...(truncated)`,
+		},
+		{
+			name: "truncated within a secret",
+			body: `{"token":"abcdefghijklmnop"}`,
+			opts: DebugOptions{MaxBodySize: 16},
+			want: `{"token":"[REDACTED]"...(truncated)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactedBody(strings.NewReader(tt.body), tt.opts); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -11,6 +11,18 @@ type Endpoint struct {
 	Password                 string
 	Insecure                 bool
 	Debug                    bool
+	// Transport tunes the connection pool of the client.
+	Transport TransportOptions
+	// RateLimit limits the requests to the endpoint, on top of the throttling headers of its responses.
+	RateLimit RateLimitOptions
+	// DebugOptions configures the request logging enabled by Debug.
+	DebugOptions DebugOptions
+	// ServerName overrides the server name used to verify the server certificate.
+	ServerName string
+	// TLSMinVersion is the minimum TLS version accepted (1.0, 1.1, 1.2 or 1.3).
+	TLSMinVersion string
+	// TLSCipherSuites restricts the cipher suites used for TLS 1.0-1.2.
+	TLSCipherSuites []string
 }
 
 // HasCA returns whether the configuration has a certificate authority or not.
@@ -0,0 +1,212 @@
+package httpcall
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimitOptions limits the requests to the endpoint, zero values keep the defaults.
+type RateLimitOptions struct {
+	// QPS is the steady rate of requests per second (no limit by default).
+	QPS float64
+	// Burst is the number of requests sent at once above the steady rate (1 by default).
+	Burst int
+	// MinRemaining is the remaining quota, as reported by the x-ms-ratelimit-remaining headers,
+	// below which the rate slows down proportionally (10 by default).
+	MinRemaining int
+}
+
+// endpointLimiter is the token bucket of an endpoint, slowed down or paused by the throttling
+// headers of its responses.
+type endpointLimiter struct {
+	mu          sync.Mutex
+	opts        RateLimitOptions
+	limiter     *rate.Limiter
+	pausedUntil time.Time
+}
+
+var limiters = struct {
+	sync.Mutex
+	endpoints map[string]*endpointLimiter
+}{endpoints: map[string]*endpointLimiter{}}
+
+// limiterForEndpoint returns the limiter of the server URL, shared by all the clients of the endpoint
+// so that its state survives credential changes.
+func limiterForEndpoint(serverURL string, opts RateLimitOptions) *endpointLimiter {
+	limiters.Lock()
+	defer limiters.Unlock()
+
+	l, ok := limiters.endpoints[serverURL]
+	if !ok {
+		l = &endpointLimiter{limiter: rate.NewLimiter(rate.Inf, 1)}
+		limiters.endpoints[serverURL] = l
+		l.configure(opts)
+	} else if l.options() != opts {
+		// The slowdown of the current limit is kept unless the options change
+		l.configure(opts)
+	}
+	return l
+}
+
+func (l *endpointLimiter) configure(opts RateLimitOptions) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.opts = opts
+	l.limiter.SetLimit(l.baseLimit())
+	l.limiter.SetBurst(valueOrDefault(opts.Burst, 1))
+}
+
+func (l *endpointLimiter) options() RateLimitOptions {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.opts
+}
+
+func (l *endpointLimiter) baseLimit() rate.Limit {
+	if l.opts.QPS <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(l.opts.QPS)
+}
+
+// wait blocks until the endpoint is not paused and a token is available.
+func (l *endpointLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	pause := time.Until(l.pausedUntil)
+	l.mu.Unlock()
+
+	if pause > 0 {
+		timer := time.NewTimer(pause)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return l.limiter.Wait(ctx)
+}
+
+// observe pauses the endpoint for the time asked by the response, and slows the rate down while the
+// remaining quota is low.
+func (l *endpointLimiter) observe(res *http.Response) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if retryAfter, ok := RetryAfter(res); ok {
+		if until := time.Now().Add(retryAfter); until.After(l.pausedUntil) {
+			l.pausedUntil = until
+		}
+	}
+
+	remaining, ok := remainingQuota(res.Header)
+	if !ok {
+		return
+	}
+	minRemaining := valueOrDefault(l.opts.MinRemaining, 10)
+	if remaining >= minRemaining {
+		l.limiter.SetLimit(l.baseLimit())
+		return
+	}
+
+	// Without a configured rate, the slowdown starts from one request per second
+	base := l.opts.QPS
+	if base <= 0 {
+		base = 1
+	}
+	slowed := base * float64(remaining+1) / float64(minRemaining+1)
+	l.limiter.SetLimit(rate.Limit(slowed))
+}
+
+// RetryAfter returns the delay asked by a throttled response, from the Retry-After header or the
+// x-ms-ratelimit-*-retry-after headers of Azure, the longest one if several are set.
+func RetryAfter(res *http.Response) (time.Duration, bool) {
+	if res == nil {
+		return 0, false
+	}
+
+	delay, found := time.Duration(0), false
+	for name, values := range res.Header {
+		name = strings.ToLower(name)
+		if name != "retry-after" && !(strings.HasPrefix(name, "x-ms-ratelimit-") && strings.HasSuffix(name, "retry-after")) {
+			continue
+		}
+		for _, value := range values {
+			d, ok := parseRetryAfter(value)
+			if ok && (!found || d > delay) {
+				delay, found = d, true
+			}
+		}
+	}
+	return delay, found
+}
+
+// parseRetryAfter parses a delay in seconds or an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+// remainingQuota returns the lowest remaining quota of the x-ms-ratelimit-*remaining* headers of Azure,
+// whose values are either a number or a list of name=number pairs (e.g. "QueryResource=10, Tenant=20").
+func remainingQuota(header http.Header) (int, bool) {
+	remaining, found := math.MaxInt, false
+	for name, values := range header {
+		name = strings.ToLower(name)
+		if !strings.HasPrefix(name, "x-ms-ratelimit-") || !strings.Contains(name, "remaining") || strings.HasSuffix(name, "retry-after") {
+			continue
+		}
+		for _, value := range values {
+			for _, part := range strings.Split(value, ",") {
+				if _, number, ok := strings.Cut(part, "="); ok {
+					part = number
+				}
+				n, err := strconv.Atoi(strings.TrimSpace(part))
+				if err == nil && n < remaining {
+					remaining, found = n, true
+				}
+			}
+		}
+	}
+	return remaining, found
+}
+
+type rateLimitWaitContextKey struct{}
+
+// rateLimitRoundTripper waits for the limiter of the endpoint before each request and
+// feeds it the throttling headers of the responses.
+type rateLimitRoundTripper struct {
+	limiter *endpointLimiter
+	rt      http.RoundTripper
+}
+
+func (rt *rateLimitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	err := rt.limiter.wait(req.Context())
+	if observe, ok := req.Context().Value(rateLimitWaitContextKey{}).(func(time.Duration)); ok {
+		observe(time.Since(start))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := rt.rt.RoundTrip(req)
+	if err == nil {
+		rt.limiter.observe(res)
+	}
+	return res, err
+}
@@ -0,0 +1,80 @@
+package httpcall
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateFuncs are the functions available to the path, headers and payload templates,
+// on top of the text/template builtins (e.g. urlquery).
+var templateFuncs = template.FuncMap{
+	"env": os.Getenv,
+	"now": func() time.Time {
+		return time.Now().UTC()
+	},
+	"date": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+	"rfc3339": func(t time.Time) string {
+		return t.Format(time.RFC3339)
+	},
+	"unix": func(t time.Time) int64 {
+		return t.Unix()
+	},
+	"utc": func(t time.Time) time.Time {
+		return t.UTC()
+	},
+	"startOfDay": func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	},
+	"startOfMonth": func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	},
+	"endOfMonth": func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()).Add(-time.Nanosecond)
+	},
+	"addDate": func(years, months, days int, t time.Time) time.Time {
+		return t.AddDate(years, months, days)
+	},
+	"add": func(duration string, t time.Time) (time.Time, error) {
+		d, err := time.ParseDuration(duration)
+		if err != nil {
+			return t, err
+		}
+		return t.Add(d), nil
+	},
+	"default": func(def string, value any) string {
+		if s := fmt.Sprint(value); value != nil && len(s) > 0 {
+			return s
+		}
+		return def
+	},
+	"json": func(value any) (string, error) {
+		b, err := json.Marshal(value)
+		return string(b), err
+	},
+}
+
+// renderTemplate executes text as a Go template with data as dot. Texts without
+// actions are returned as they are.
+func renderTemplate(name, text string, data map[string]any) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse %s template: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("unable to render %s template: %w", name, err)
+	}
+	return buf.String(), nil
+}
@@ -7,14 +7,13 @@ import (
 	"fmt"
 	"net"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
-	"os"
+	"strings"
 	"time"
 )
 
 func tlsConfigFor(e *Endpoint) (http.RoundTripper, error) {
-	res := defaultTransport()
+	res := defaultTransport(e.Transport)
 
 	if e.ProxyURL != "" {
 		u, err := parseProxyURL(e.ProxyURL)
@@ -25,63 +24,177 @@ func tlsConfigFor(e *Endpoint) (http.RoundTripper, error) {
 		res.Proxy = http.ProxyURL(u)
 	}
 
-	if !e.HasCertAuth() {
-		if e.Insecure {
-			res.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	tlsConfig, err := tlsClientConfigFor(e)
+	if err != nil {
+		return nil, err
+	}
+
+	res.TLSClientConfig = tlsConfig
+	return res, nil
+}
+
+// tlsClientConfigFor builds the TLS configuration of the endpoint. The certificate
+// authority data is honored whatever the authentication method is, and it is
+// added on top of the system roots.
+func tlsClientConfigFor(e *Endpoint) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         e.ServerName,
+		InsecureSkipVerify: e.Insecure,
+	}
+
+	if len(e.TLSMinVersion) > 0 {
+		v, err := parseTLSVersion(e.TLSMinVersion)
+		if err != nil {
+			return nil, err
 		}
-		return res, nil
+		tlsConfig.MinVersion = v
 	}
 
-	certData, err := base64.StdEncoding.DecodeString(e.ClientCertificateData)
+	if len(e.TLSCipherSuites) > 0 {
+		ids, err := parseCipherSuites(e.TLSCipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.CipherSuites = ids
+	}
+
+	if e.HasCA() {
+		caData, err := decodePEMData(e.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode certificate authority data")
+		}
+
+		caCertPool, err := x509.SystemCertPool()
+		if err != nil || caCertPool == nil {
+			caCertPool = x509.NewCertPool()
+		}
+		if !caCertPool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("no valid certificate found in certificate authority data")
+		}
+
+		tlsConfig.RootCAs = caCertPool
+	}
+
+	if !e.HasCertAuth() {
+		return tlsConfig, nil
+	}
+
+	certData, err := decodePEMData(e.ClientCertificateData)
 	if err != nil {
 		return nil, fmt.Errorf("unable to decode client certificate data")
 	}
 
-	keyData, err := base64.StdEncoding.DecodeString(e.ClientKeyData)
+	keyData, err := decodePEMData(e.ClientKeyData)
 	if err != nil {
 		return nil, fmt.Errorf("unable to decode client key data")
 	}
 
 	cert, err := tls.X509KeyPair(certData, keyData)
 	if err != nil {
-		return res, err
+		return nil, err
 	}
 
-	caCertPool := x509.NewCertPool()
-
-	if len(e.CertificateAuthorityData) > 0 {
-		caData, err := base64.StdEncoding.DecodeString(e.CertificateAuthorityData)
-		if err != nil {
-			return nil, fmt.Errorf("unable to decode certificate authority data")
-		}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+	return tlsConfig, nil
+}
 
-		caCertPool.AppendCertsFromPEM(caData)
+// decodePEMData accepts either PEM data or base64 encoded PEM data, as found in kubeconfig files.
+func decodePEMData(data string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(data), "-----BEGIN") {
+		return []byte(data), nil
 	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+}
 
-	tlsConfig := &tls.Config{
-		RootCAs:      caCertPool,
-		Certificates: []tls.Certificate{cert},
+func parseTLSVersion(version string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(version)), "tls") {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version %q, must be one of 1.0, 1.1, 1.2 or 1.3", version)
+}
+
+func parseCipherSuites(names []string) ([]uint16, error) {
+	known := map[string]uint16{}
+	for _, cs := range tls.CipherSuites() {
+		known[cs.Name] = cs.ID
+	}
+	for _, cs := range tls.InsecureCipherSuites() {
+		known[cs.Name] = cs.ID
 	}
 
-	res.TLSClientConfig = tlsConfig
+	res := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported cipher suite %q", name)
+		}
+		res = append(res, id)
+	}
 	return res, nil
 }
 
-func defaultTransport() *http.Transport {
+// TransportOptions tunes the connection pool of the endpoint client, zero values keep the defaults.
+type TransportOptions struct {
+	// Timeout is the overall time limit of a request, including reading the body (no limit by default).
+	Timeout time.Duration
+	// DialTimeout is the time limit to establish a connection (30s by default).
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout is the time limit of the TLS handshake (10s by default).
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout is the time limit to receive the response headers (no limit by default).
+	ResponseHeaderTimeout time.Duration
+	// IdleConnTimeout is how long an idle connection is kept in the pool (90s by default).
+	IdleConnTimeout time.Duration
+	// MaxIdleConns is the maximum number of idle connections (100 by default).
+	MaxIdleConns int
+	// MaxIdleConnsPerHost is the maximum number of idle connections per host (2 by default).
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost is the maximum number of connections per host (no limit by default).
+	MaxConnsPerHost int
+	// DisableHTTP2 forces HTTP/1.1.
+	DisableHTTP2 bool
+}
+
+func defaultTransport(opts TransportOptions) *http.Transport {
 	dialer := &net.Dialer{
-		Timeout:   30 * time.Second,
+		Timeout:   valueOrDefault(opts.DialTimeout, 30*time.Second),
 		KeepAlive: 30 * time.Second,
 	}
 
-	return &http.Transport{
+	res := &http.Transport{
 		Proxy:                 http.ProxyFromEnvironment,
 		DialContext:           dialer.DialContext,
-		ForceAttemptHTTP2:     true,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
+		ForceAttemptHTTP2:     !opts.DisableHTTP2,
+		MaxIdleConns:          valueOrDefault(opts.MaxIdleConns, 100),
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+		IdleConnTimeout:       valueOrDefault(opts.IdleConnTimeout, 90*time.Second),
+		TLSHandshakeTimeout:   valueOrDefault(opts.TLSHandshakeTimeout, 10*time.Second),
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
 		ExpectContinueTimeout: 1 * time.Second,
 	}
+
+	if opts.DisableHTTP2 {
+		// A non-nil empty map disables the HTTP/2 upgrade
+		res.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	return res
+}
+
+func valueOrDefault[T comparable](value, def T) T {
+	var zero T
+	if value == zero {
+		return def
+	}
+	return value
 }
 
 func parseProxyURL(proxyURL string) (*url.URL, error) {
@@ -98,36 +211,6 @@ func parseProxyURL(proxyURL string) (*url.URL, error) {
 	return u, nil
 }
 
-type debuggingRoundTripper struct {
-	delegatedRoundTripper http.RoundTripper
-}
-
-func (rt *debuggingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	b, err := httputil.DumpRequestOut(req, true)
-	if err != nil {
-		return nil, err
-	}
-	os.Stderr.Write(b)
-	os.Stderr.WriteString("\n\n")
-
-	resp, err := rt.delegatedRoundTripper.RoundTrip(req)
-
-	// If an error was returned, dump it to os.Stderr.
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return resp, err
-	}
-
-	b, err = httputil.DumpResponse(resp, req.URL.Query().Get("watch") != "true")
-	if err != nil {
-		return nil, err
-	}
-	os.Stderr.Write(b)
-	os.Stderr.Write([]byte{'\n'})
-
-	return resp, err
-}
-
 type basicAuthRoundTripper struct {
 	username string
 	password string `datapolicy:"password"`
@@ -0,0 +1,89 @@
+package openmetrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentType is the content type of the OpenMetrics text format.
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Sample is a gauge sample with its own timestamp.
+type Sample struct {
+	Name      string
+	Labels    map[string]string
+	Value     float64
+	Timestamp time.Time
+}
+
+// Write writes the samples in the OpenMetrics text format, grouped by metric family and
+// sorted by series and timestamp, as expected by promtool tsdb create-blocks-from openmetrics.
+func Write(w io.Writer, samples []Sample) error {
+	type line struct {
+		series    string
+		timestamp time.Time
+		text      string
+	}
+
+	families := map[string][]line{}
+	for _, sample := range samples {
+		series := sample.Name + formatLabels(sample.Labels)
+		text := series + " " + strconv.FormatFloat(sample.Value, 'g', -1, 64)
+		if !sample.Timestamp.IsZero() {
+			text += " " + strconv.FormatFloat(float64(sample.Timestamp.UnixMilli())/1000, 'f', 3, 64)
+		}
+		families[sample.Name] = append(families[sample.Name], line{series: series, timestamp: sample.Timestamp, text: text})
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		lines := families[name]
+		sort.SliceStable(lines, func(i, j int) bool {
+			if lines[i].series != lines[j].series {
+				return lines[i].series < lines[j].series
+			}
+			return lines[i].timestamp.Before(lines[j].timestamp)
+		})
+
+		if _, err := fmt.Fprintf(w, "# TYPE %s gauge\n", name); err != nil {
+			return err
+		}
+		for _, l := range lines {
+			if _, err := fmt.Fprintln(w, l.text); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintln(w, "# EOF")
+	return err
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, labelValueReplacer.Replace(labels[name]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
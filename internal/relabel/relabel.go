@@ -0,0 +1,225 @@
+package relabel
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/config"
+)
+
+// MetricNameLabel holds the metric name while relabeling.
+const MetricNameLabel = "__name__"
+
+// Rule is a compiled relabel config.
+type Rule struct {
+	sourceLabels []string
+	separator    string
+	regex        *regexp.Regexp
+	modulus      uint64
+	targetLabel  string
+	replacement  string
+	action       string
+}
+
+// Compile validates the relabel configs and compiles their regular expressions.
+func Compile(cfgs []config.RelabelConfig) ([]Rule, error) {
+	rules := make([]Rule, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		rule := Rule{
+			sourceLabels: cfg.SourceLabels,
+			separator:    cfg.Separator,
+			modulus:      cfg.Modulus,
+			targetLabel:  cfg.TargetLabel,
+			replacement:  "$1",
+			action:       strings.ToLower(cfg.Action),
+		}
+		if rule.separator == "" {
+			rule.separator = ";"
+		}
+		if cfg.Replacement != nil {
+			rule.replacement = *cfg.Replacement
+		}
+		if rule.action == "" {
+			rule.action = "replace"
+		}
+
+		expr := cfg.Regex
+		if expr == "" {
+			expr = "(.*)"
+		}
+		regex, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("relabel config %d: invalid regex %q: %w", i, cfg.Regex, err)
+		}
+		rule.regex = regex
+
+		switch rule.action {
+		case "replace", "hashmod":
+			if rule.targetLabel == "" {
+				return nil, fmt.Errorf("relabel config %d: %s requires a target label", i, rule.action)
+			}
+			if rule.action == "hashmod" && rule.modulus == 0 {
+				return nil, fmt.Errorf("relabel config %d: hashmod requires a modulus", i)
+			}
+		case "keep", "drop", "labelmap", "labeldrop", "labelkeep":
+		default:
+			return nil, fmt.Errorf("relabel config %d: unknown action %q", i, cfg.Action)
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Process applies the rules to a copy of the labels. It returns false if the series is dropped.
+func Process(labels map[string]string, rules []Rule) (map[string]string, bool) {
+	res := make(map[string]string, len(labels))
+	for name, value := range labels {
+		res[name] = value
+	}
+
+	for _, rule := range rules {
+		values := make([]string, len(rule.sourceLabels))
+		for i, name := range rule.sourceLabels {
+			values[i] = res[name]
+		}
+		value := strings.Join(values, rule.separator)
+
+		switch rule.action {
+		case "keep":
+			if !rule.regex.MatchString(value) {
+				return nil, false
+			}
+		case "drop":
+			if rule.regex.MatchString(value) {
+				return nil, false
+			}
+		case "replace":
+			indexes := rule.regex.FindStringSubmatchIndex(value)
+			if indexes == nil {
+				continue
+			}
+			target := string(rule.regex.ExpandString(nil, rule.targetLabel, value, indexes))
+			replacement := string(rule.regex.ExpandString(nil, rule.replacement, value, indexes))
+			if replacement == "" {
+				delete(res, target)
+			} else {
+				res[target] = replacement
+			}
+		case "hashmod":
+			sum := md5.Sum([]byte(value))
+			res[rule.targetLabel] = fmt.Sprint(binary.BigEndian.Uint64(sum[8:]) % rule.modulus)
+		case "labelmap":
+			mapped := map[string]string{}
+			for name, labelValue := range res {
+				if indexes := rule.regex.FindStringSubmatchIndex(name); indexes != nil {
+					mapped[string(rule.regex.ExpandString(nil, rule.replacement, name, indexes))] = labelValue
+				}
+			}
+			for name, labelValue := range mapped {
+				res[name] = labelValue
+			}
+		case "labeldrop":
+			for name := range res {
+				if rule.regex.MatchString(name) {
+					delete(res, name)
+				}
+			}
+		case "labelkeep":
+			for name := range res {
+				if name != MetricNameLabel && !rule.regex.MatchString(name) {
+					delete(res, name)
+				}
+			}
+		}
+	}
+
+	return res, true
+}
+
+var (
+	invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_:]+`)
+	nameReplacer     = strings.NewReplacer("%", "_percent_", "/", "_per_")
+)
+
+// SanitizeMetricName turns a name into a valid Prometheus metric name, e.g.
+// "percentage cpu" into percentage_cpu and "network in/sec" into network_in_per_sec.
+func SanitizeMetricName(name string) string {
+	name = nameReplacer.Replace(name)
+	name = invalidNameChars.ReplaceAllString(name, "_")
+	for strings.Contains(name, "__") {
+		name = strings.ReplaceAll(name, "__", "_")
+	}
+	name = strings.Trim(name, "_")
+	if name == "" {
+		return "unnamed"
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// SanitizeLabelNames turns column names into valid and unique Prometheus label names:
+// BOM remnants are removed, invalid characters are replaced with underscores, the reserved
+// __ prefix is reduced to a single underscore and names starting with a digit are prefixed
+// with an underscore. Colliding names get a numeric suffix (_2, _3, ...).
+func SanitizeLabelNames(names []string, snakeCase bool) []string {
+	res := make([]string, len(names))
+	used := map[string]bool{}
+	for i, name := range names {
+		name = strings.ReplaceAll(name, "\ufeff", "")
+		if snakeCase {
+			name = toSnakeCase(name)
+		}
+		name = invalidLabelChars.ReplaceAllString(strings.TrimSpace(name), "_")
+		for strings.HasPrefix(name, "__") {
+			name = strings.TrimPrefix(name, "_")
+		}
+		if name == "" {
+			name = "_"
+		}
+		if name[0] >= '0' && name[0] <= '9' {
+			name = "_" + name
+		}
+
+		unique := name
+		for n := 2; used[unique]; n++ {
+			unique = fmt.Sprintf("%s_%d", name, n)
+		}
+		used[unique] = true
+		res[i] = unique
+	}
+	return res
+}
+
+// toSnakeCase converts camel case names, e.g. BilledCost to billed_cost and HTTPStatus to http_status.
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	var sb strings.Builder
+	for i, r := range runes {
+		isUpper := r >= 'A' && r <= 'Z'
+		if isUpper && i > 0 {
+			prev := runes[i-1]
+			prevLowerOrDigit := (prev >= 'a' && prev <= 'z') || (prev >= '0' && prev <= '9')
+			nextLower := i+1 < len(runes) && runes[i+1] >= 'a' && runes[i+1] <= 'z'
+			prevUpper := prev >= 'A' && prev <= 'Z'
+			if prevLowerOrDigit || (prevUpper && nextLower) {
+				sb.WriteByte('_')
+			}
+		}
+		if isUpper {
+			r += 'a' - 'A'
+		}
+		if r == ' ' || r == '-' || r == '.' {
+			r = '_'
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
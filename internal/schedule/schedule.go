@@ -0,0 +1,238 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule returns the start time of the next scrape.
+type Schedule interface {
+	// Next returns the first start time strictly after t.
+	Next(t time.Time) time.Time
+}
+
+// Aligned starts the scrapes on the multiples of the interval in the location, shifted by the offset,
+// e.g. on the hour with a 1h interval.
+type Aligned struct {
+	Interval time.Duration
+	Offset   time.Duration
+	Location *time.Location
+}
+
+func (a Aligned) Next(t time.Time) time.Time {
+	if a.Interval <= 0 {
+		return t
+	}
+	loc := a.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	// The multiples are counted on the wall clock of the location
+	_, zoneOffset := t.In(loc).Zone()
+	shift := time.Duration(zoneOffset)*time.Second - a.Offset
+
+	next := t.Add(shift).Truncate(a.Interval).Add(a.Interval).Add(-shift)
+	for !next.After(t) {
+		next = next.Add(a.Interval)
+	}
+	return next
+}
+
+// Cron starts the scrapes on the minutes matched by a cron expression.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	// A day matches either field when both are restricted
+	domAny, dowAny bool
+	location       *time.Location
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	dayNames   = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// ParseCron parses a cron expression with five fields (minute, hour, day of month, month and day of week)
+// or one of the descriptors @yearly, @monthly, @weekly, @daily and @hourly. The fields accept *, lists,
+// ranges, steps and the names of the months and days.
+func ParseCron(expr string, loc *time.Location) (*Cron, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	spec := strings.TrimSpace(expr)
+	if descriptor, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = descriptor
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, found %d", expr, len(fields))
+	}
+
+	c := &Cron{location: loc}
+	var err error
+	if c.minute, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("error while parsing minute of cron expression %q: %w", expr, err)
+	}
+	if c.hour, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("error while parsing hour of cron expression %q: %w", expr, err)
+	}
+	if c.dom, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("error while parsing day of month of cron expression %q: %w", expr, err)
+	}
+	if c.month, err = parseField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("error while parsing month of cron expression %q: %w", expr, err)
+	}
+	if c.dow, err = parseField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("error while parsing day of week of cron expression %q: %w", expr, err)
+	}
+	// 7 is Sunday as well
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny = strings.HasPrefix(fields[2], "*")
+	c.dowAny = strings.HasPrefix(fields[4], "*")
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never matches", expr)
+	}
+	return c, nil
+}
+
+// parseField parses a comma separated list of *, values and ranges, each with an optional step.
+func parseField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+		}
+
+		low, high := min, max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			low, err = parseValue(lowPart, names)
+			if err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				high, err = parseValue(highPart, names)
+				if err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q is out of the range %d-%d", part, min, max)
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(value string, names map[string]int) (int, error) {
+	if n, ok := names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	return n, nil
+}
+
+// allHours is the hour field matching every hour.
+const allHours = 1<<24 - 1
+
+// Next returns the first matching minute after t, or the zero time if the expression never matches.
+// Expressions matching every hour run on every matching minute, including the minutes repeated when the
+// clocks are turned back. The others match the wall clock, so that the changes of the zone offset neither
+// repeat nor skip their scrapes: a repeated time runs once, a skipped one right after the clocks jump.
+func (c *Cron) Next(t time.Time) time.Time {
+	if c.hour == allHours {
+		return c.match(t.In(c.location).Truncate(time.Minute).Add(time.Minute), c.location)
+	}
+
+	wall := wallClock(t, c.location).Add(time.Minute)
+	for {
+		wall = c.match(wall, time.UTC)
+		if wall.IsZero() {
+			return wall
+		}
+		next := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, c.location)
+		for wallClock(next, c.location).Before(wall) {
+			next = next.Add(time.Minute)
+		}
+		if next.After(t) {
+			return next
+		}
+		wall = wall.Add(time.Minute)
+	}
+}
+
+// match returns the first matching minute from the given one, in the location.
+func (c *Cron) match(next time.Time, loc *time.Location) time.Time {
+	// A matching minute is found within a few years, unless the expression never matches (e.g. 30 February)
+	limit := next.AddDate(5, 0, 0)
+	for next.Before(limit) {
+		switch {
+		case c.month&(1<<uint(next.Month())) == 0:
+			next = advance(next, time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, loc))
+		case !c.dayMatches(next):
+			next = advance(next, time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, loc))
+		case c.hour&(1<<uint(next.Hour())) == 0:
+			next = advance(next, time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, loc))
+		case c.minute&(1<<uint(next.Minute())) == 0:
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// advance returns the start of the following month, day or hour, or the following minute when a change
+// of the zone offset skips that start and time.Date normalizes it to an earlier time.
+func advance(from, to time.Time) time.Time {
+	if to.After(from) {
+		return to
+	}
+	return from.Add(time.Minute)
+}
+
+// wallClock returns the wall clock of t in the location, as a UTC time.
+func wallClock(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,245 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s not available: %v", name, err)
+	}
+	return loc
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: "* * * * *"},
+		{expr: "*/15 9-17 * * mon-fri"},
+		{expr: "0 0 1,15 jan,jul *"},
+		{expr: "5 4 * * 7"},
+		{expr: "@hourly"},
+		{expr: "@DAILY"},
+		{expr: "0 0 29 2 *"},
+		{expr: "* * * *", wantErr: true},
+		{expr: "* * * * * *", wantErr: true},
+		{expr: "60 * * * *", wantErr: true},
+		{expr: "* 24 * * *", wantErr: true},
+		{expr: "* * 0 * *", wantErr: true},
+		{expr: "* * * 13 *", wantErr: true},
+		{expr: "* * * * 8", wantErr: true},
+		{expr: "*/0 * * * *", wantErr: true},
+		{expr: "10-5 * * * *", wantErr: true},
+		{expr: "* * * foo *", wantErr: true},
+		{expr: "@every 5m", wantErr: true},
+		// Never matching expressions
+		{expr: "0 0 30 2 *", wantErr: true},
+		{expr: "0 0 31 apr,jun,sep,nov *", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseCron(tt.expr, nil)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCron(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	date := func(s string) time.Time {
+		d, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from string
+		want string
+	}{
+		{name: "every minute", expr: "* * * * *", from: "2025-01-01T10:00:30Z", want: "2025-01-01T10:01:00Z"},
+		{name: "strictly after", expr: "0 * * * *", from: "2025-01-01T10:00:00Z", want: "2025-01-01T11:00:00Z"},
+		{name: "step", expr: "*/20 * * * *", from: "2025-01-01T10:41:00Z", want: "2025-01-01T11:00:00Z"},
+		{name: "range with step", expr: "0 8-18/5 * * *", from: "2025-01-01T13:01:00Z", want: "2025-01-01T18:00:00Z"},
+		{name: "list", expr: "15,45 6 * * *", from: "2025-01-01T06:20:00Z", want: "2025-01-01T06:45:00Z"},
+		{name: "month names", expr: "0 0 1 jul *", from: "2025-02-10T00:00:00Z", want: "2025-07-01T00:00:00Z"},
+		{name: "day of week", expr: "0 9 * * mon", from: "2025-01-01T00:00:00Z", want: "2025-01-06T09:00:00Z"},
+		{name: "sunday as 7", expr: "0 9 * * 7", from: "2025-01-01T00:00:00Z", want: "2025-01-05T09:00:00Z"},
+		{name: "day of month or day of week", expr: "0 0 15 * fri", from: "2025-01-01T00:00:00Z", want: "2025-01-03T00:00:00Z"},
+		{name: "day of month or day of week, day of month first", expr: "0 0 2 * fri", from: "2025-01-01T00:00:00Z", want: "2025-01-02T00:00:00Z"},
+		{name: "day of month with any day of week", expr: "0 0 15 * *", from: "2025-01-01T00:00:00Z", want: "2025-01-15T00:00:00Z"},
+		{name: "day of week with any day of month", expr: "0 0 * * fri", from: "2025-01-04T00:00:00Z", want: "2025-01-10T00:00:00Z"},
+		// A stepped * restricts the day like *, as in Vixie cron
+		{name: "stepped any day of month and day of week", expr: "0 0 */10 * sun", from: "2025-01-01T01:00:00Z", want: "2025-05-11T00:00:00Z"},
+		{name: "leap day", expr: "0 0 29 2 *", from: "2025-01-01T00:00:00Z", want: "2028-02-29T00:00:00Z"},
+		{name: "end of year", expr: "@yearly", from: "2025-06-01T00:00:00Z", want: "2026-01-01T00:00:00Z"},
+		{name: "weekly", expr: "@weekly", from: "2025-01-01T00:00:00Z", want: "2025-01-05T00:00:00Z"},
+		{name: "monthly", expr: "@monthly", from: "2025-01-31T23:59:00Z", want: "2025-02-01T00:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCron(tt.expr, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Next(date(tt.from)); !got.Equal(date(tt.want)) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got.Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
+
+func TestCronNextDST(t *testing.T) {
+	loc := mustLoadLocation(t, "America/New_York")
+	// The clocks of Santiago jump from 00:00 to 01:00, skipping midnight
+	santiago := mustLoadLocation(t, "America/Santiago")
+
+	tests := []struct {
+		name string
+		expr string
+		loc  *time.Location
+		from time.Time
+		want []time.Time
+	}{
+		{
+			// 02:30 does not exist on 9 March, the scrape runs when the clocks jump to 03:00
+			name: "skipped time",
+			expr: "30 2 * * *",
+			loc:  loc,
+			from: time.Date(2025, 3, 8, 12, 0, 0, 0, loc),
+			want: []time.Time{
+				time.Date(2025, 3, 9, 3, 0, 0, 0, loc),
+				time.Date(2025, 3, 10, 2, 30, 0, 0, loc),
+			},
+		},
+		{
+			// 01:30 happens twice on 2 November, the scrape runs once
+			name: "repeated time",
+			expr: "30 1 * * *",
+			loc:  loc,
+			from: time.Date(2025, 11, 1, 12, 0, 0, 0, loc),
+			want: []time.Time{
+				time.Date(2025, 11, 2, 5, 30, 0, 0, time.UTC),
+				time.Date(2025, 11, 3, 6, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			// Every hour runs in both the repeated hours
+			name: "every hour on a repeated hour",
+			expr: "30 * * * *",
+			loc:  loc,
+			from: time.Date(2025, 11, 2, 5, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2025, 11, 2, 5, 30, 0, 0, time.UTC),
+				time.Date(2025, 11, 2, 6, 30, 0, 0, time.UTC),
+				time.Date(2025, 11, 2, 7, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			// Every hour skips the hour that does not exist
+			name: "every hour on a skipped hour",
+			expr: "30 * * * *",
+			loc:  loc,
+			from: time.Date(2025, 3, 9, 6, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2025, 3, 9, 6, 30, 0, 0, time.UTC),
+				time.Date(2025, 3, 9, 7, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "every hour on a skipped midnight",
+			expr: "30 * 7 sep *",
+			loc:  santiago,
+			from: time.Date(2025, 9, 6, 22, 0, 0, 0, santiago),
+			want: []time.Time{
+				time.Date(2025, 9, 7, 1, 30, 0, 0, santiago),
+				time.Date(2025, 9, 7, 2, 30, 0, 0, santiago),
+			},
+		},
+		{
+			name: "daily on a skipped midnight",
+			expr: "@daily",
+			loc:  santiago,
+			from: time.Date(2025, 9, 6, 12, 0, 0, 0, santiago),
+			want: []time.Time{
+				time.Date(2025, 9, 7, 1, 0, 0, 0, santiago),
+				time.Date(2025, 9, 8, 0, 0, 0, 0, santiago),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCron(tt.expr, tt.loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			next := tt.from
+			for _, want := range tt.want {
+				next = c.Next(next)
+				if !next.Equal(want) {
+					t.Fatalf("got %s, want %s", next.In(tt.loc).Format(time.RFC3339), want.In(tt.loc).Format(time.RFC3339))
+				}
+			}
+		})
+	}
+}
+
+func TestAlignedNext(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+
+	tests := []struct {
+		name    string
+		aligned Aligned
+		from    time.Time
+		want    time.Time
+	}{
+		{
+			name:    "on the hour",
+			aligned: Aligned{Interval: time.Hour},
+			from:    time.Date(2025, 1, 1, 10, 20, 0, 0, time.UTC),
+			want:    time.Date(2025, 1, 1, 11, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "strictly after",
+			aligned: Aligned{Interval: time.Hour},
+			from:    time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC),
+			want:    time.Date(2025, 1, 1, 11, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "offset",
+			aligned: Aligned{Interval: time.Hour, Offset: 5 * time.Minute},
+			from:    time.Date(2025, 1, 1, 10, 2, 0, 0, time.UTC),
+			want:    time.Date(2025, 1, 1, 10, 5, 0, 0, time.UTC),
+		},
+		{
+			name:    "midnight of the location",
+			aligned: Aligned{Interval: 24 * time.Hour, Location: berlin},
+			from:    time.Date(2025, 1, 1, 12, 0, 0, 0, berlin),
+			want:    time.Date(2025, 1, 2, 0, 0, 0, 0, berlin),
+		},
+		{
+			name:    "zero interval",
+			aligned: Aligned{},
+			from:    time.Date(2025, 1, 1, 10, 20, 0, 0, time.UTC),
+			want:    time.Date(2025, 1, 1, 10, 20, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.aligned.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
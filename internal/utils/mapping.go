@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/util/jsonpath"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/config"
+)
+
+/*
+* Maps an arbitrary JSON document to records, as configured by the mapping.
+* @param data The JSON document
+* @param mapping The rows and columns paths
+* @return the records, with the column names as first record
+ */
+func MapJSONRecords(data []byte, mapping config.Mapping) ([][]string, error) {
+	if len(mapping.Rows) == 0 || len(mapping.Columns) == 0 {
+		return nil, fmt.Errorf("the json mapping requires rows and columns")
+	}
+
+	var document any
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("error decoding json response: %w", err)
+	}
+
+	rows, err := findJSONPath("rows", mapping.Rows, document)
+	if err != nil {
+		return nil, err
+	}
+	// A path selecting the array instead of its items, e.g. {.value}
+	if len(rows) == 1 && !strings.Contains(mapping.Rows, "[*]") {
+		array := rows[0]
+		for array.Kind() == reflect.Interface {
+			array = array.Elem()
+		}
+		if array.Kind() == reflect.Slice {
+			rows = []reflect.Value{}
+			for i := 0; i < array.Len(); i++ {
+				rows = append(rows, array.Index(i))
+			}
+		}
+	}
+
+	header := make([]string, len(mapping.Columns))
+	for i, column := range mapping.Columns {
+		header[i] = column.Name
+	}
+	records := [][]string{header}
+
+	// Columns evaluated against the whole document have the same value for every row
+	rootValues := map[int]string{}
+	for i, column := range mapping.Columns {
+		if strings.HasPrefix(strings.TrimPrefix(column.Path, "{"), "$") {
+			values, err := findJSONPath(column.Name, column.Path, document)
+			if err != nil {
+				return nil, err
+			}
+			rootValues[i] = jsonValueString(values)
+		}
+	}
+
+	for _, row := range rows {
+		record := make([]string, len(mapping.Columns))
+		for i, column := range mapping.Columns {
+			if value, ok := rootValues[i]; ok {
+				record[i] = value
+				continue
+			}
+			values, err := findJSONPath(column.Name, column.Path, row.Interface())
+			if err != nil {
+				return nil, err
+			}
+			record[i] = jsonValueString(values)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func findJSONPath(name, path string, data any) ([]reflect.Value, error) {
+	if !strings.HasPrefix(path, "{") {
+		path = "{" + path + "}"
+	}
+
+	jp := jsonpath.New(name).AllowMissingKeys(true)
+	if err := jp.Parse(path); err != nil {
+		return nil, fmt.Errorf("invalid path %s for %s: %w", path, name, err)
+	}
+
+	results, err := jp.FindResults(data)
+	if err != nil {
+		return nil, fmt.Errorf("error evaluating path %s for %s: %w", path, name, err)
+	}
+
+	values := []reflect.Value{}
+	for _, result := range results {
+		values = append(values, result...)
+	}
+	return values, nil
+}
+
+// jsonValueString formats the first value found, scalars as they are and objects as JSON.
+func jsonValueString(values []reflect.Value) string {
+	if len(values) == 0 || !values[0].IsValid() {
+		return ""
+	}
+
+	value := values[0].Interface()
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(b)
+}
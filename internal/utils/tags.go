@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+* Parses a Tags column: a JSON object, as in FOCUS reports, or a list of key=value (or key:value) pairs separated by semicolons.
+* @param value The value of the Tags column
+* @return the tags, empty if the value cannot be parsed
+ */
+func ParseTags(value string) map[string]string {
+	tags := map[string]string{}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return tags
+	}
+
+	if strings.HasPrefix(value, "{") {
+		parsed := map[string]any{}
+		if err := json.Unmarshal([]byte(value), &parsed); err == nil {
+			for key, tagValue := range parsed {
+				switch v := tagValue.(type) {
+				case string:
+					tags[key] = v
+				case nil:
+					tags[key] = ""
+				default:
+					data, _ := json.Marshal(v)
+					tags[key] = string(data)
+				}
+			}
+			return tags
+		}
+	}
+
+	for _, pair := range strings.Split(value, ";") {
+		key, tagValue, ok := strings.Cut(pair, "=")
+		if !ok {
+			key, tagValue, ok = strings.Cut(pair, ":")
+		}
+		if ok && len(strings.TrimSpace(key)) > 0 {
+			tags[strings.TrimSpace(key)] = strings.TrimSpace(tagValue)
+		}
+	}
+	return tags
+}
+
+/*
+* Flattens the tags into a single label value, key:value pairs sorted by key and separated by semicolons.
+* @param tags The tags
+* @return the flattened tags
+ */
+func FlattenTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf("%s:%s", key, tags[key])
+	}
+	return strings.Join(pairs, ";")
+}
@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	// Embed the timezone database, the container image has none
+	_ "time/tzdata"
+)
+
+// TimeWindowOptions controls the time window variables.
+type TimeWindowOptions struct {
+	// Timezone is the IANA name of the timezone of the variables (UTC by default).
+	Timezone string
+	// Format is rfc3339 (default), date, unix, unixMilli or a Go time layout.
+	Format string
+	// Formats overrides Format for single variables.
+	Formats map[string]string
+	// BillingPeriodStartDay is the day of the month billing periods start on (1 by default).
+	BillingPeriodStartDay int
+	// InitialLookback is used for lastScrapeTime before the first successful scrape (24h by default).
+	InitialLookback time.Duration
+}
+
+// nowMinusRegex matches the now-<duration> variables, e.g. now-24h
+var nowMinusRegex = regexp.MustCompile(`^now-([0-9a-z.]+)$`)
+
+/*
+* Computes the time window variables for the current time:
+* now, billingPeriodStart, billingPeriodEnd, previousBillingPeriodStart, previousBillingPeriodEnd and lastScrapeTime.
+* @param now The current time
+* @param lastScrape The time of the last successful scrape, zero if none
+* @param opts The timezone, format and billing period settings
+* @return the formatted variables
+ */
+func TimeWindowVariables(now, lastScrape time.Time, opts TimeWindowOptions) (map[string]string, error) {
+	loc, err := timeWindowLocation(opts)
+	if err != nil {
+		return nil, err
+	}
+	now = now.In(loc)
+
+	startDay := opts.BillingPeriodStartDay
+	if startDay == 0 {
+		startDay = 1
+	}
+	if startDay < 1 || startDay > 28 {
+		return nil, fmt.Errorf("billing period start day must be between 1 and 28, got %d", startDay)
+	}
+
+	periodStart := time.Date(now.Year(), now.Month(), startDay, 0, 0, 0, 0, loc)
+	if now.Before(periodStart) {
+		periodStart = periodStart.AddDate(0, -1, 0)
+	}
+	previousPeriodStart := periodStart.AddDate(0, -1, 0)
+
+	if lastScrape.IsZero() {
+		lookback := opts.InitialLookback
+		if lookback == 0 {
+			lookback = 24 * time.Hour
+		}
+		lastScrape = now.Add(-lookback)
+	}
+
+	times := map[string]time.Time{
+		"now":                        now,
+		"billingPeriodStart":         periodStart,
+		"billingPeriodEnd":           periodStart.AddDate(0, 1, 0).Add(-time.Second),
+		"previousBillingPeriodStart": previousPeriodStart,
+		"previousBillingPeriodEnd":   periodStart.Add(-time.Second),
+		"lastScrapeTime":             lastScrape.In(loc),
+	}
+
+	res := map[string]string{}
+	for name, t := range times {
+		res[name] = formatTimeVariable(name, t, opts)
+	}
+	return res, nil
+}
+
+/*
+* Returns a lookup of the time window variables for ReplaceVariables.
+* Besides the variables computed by TimeWindowVariables, now-DURATION (e.g. now-24h) is resolved to the current time minus the duration.
+* @param now The current time
+* @param variables The variables computed by TimeWindowVariables
+* @param opts The timezone and format settings
+* @return the lookup function
+ */
+func TimeVariablesLookup(now time.Time, variables map[string]string, opts TimeWindowOptions) func(name string) (string, bool) {
+	loc, err := timeWindowLocation(opts)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	return func(name string) (string, bool) {
+		if value, ok := variables[name]; ok {
+			return value, true
+		}
+
+		if sub := nowMinusRegex.FindStringSubmatch(name); sub != nil {
+			d, err := parseLookback(sub[1])
+			if err == nil {
+				return formatTimeVariable(name, now.In(loc).Add(-d), opts), true
+			}
+		}
+		return "", false
+	}
+}
+
+// parseLookback parses Go durations, plus a number of days with the d unit (e.g. 7d).
+func parseLookback(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+func timeWindowLocation(opts TimeWindowOptions) (*time.Location, error) {
+	if opts.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(opts.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %s: %w", opts.Timezone, err)
+	}
+	return loc, nil
+}
+
+func formatTimeVariable(name string, t time.Time, opts TimeWindowOptions) string {
+	format := opts.Format
+	if f, ok := opts.Formats[name]; ok {
+		format = f
+	}
+
+	switch strings.ToLower(format) {
+	case "", "rfc3339":
+		return t.Format(time.RFC3339)
+	case "date":
+		return t.Format(time.DateOnly)
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "unixmilli":
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	}
+	return t.Format(format)
+}
+
+/*
+* Parses a time value of the records.
+* @param value The value to parse
+* @param layout rfc3339 (default), date, unix, unixMilli or a Go time layout
+* @return the parsed time
+ */
+func ParseTime(value string, layout string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(layout) {
+	case "", "rfc3339":
+		return time.Parse(time.RFC3339, value)
+	case "date":
+		return time.Parse(time.DateOnly, value)
+	case "unix":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(n, 0), nil
+	case "unixmilli":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.UnixMilli(n), nil
+	}
+	return time.Parse(layout, value)
+}
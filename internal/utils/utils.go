@@ -2,17 +2,14 @@ package utils
 
 import (
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
-	"os"
 	"reflect"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/rs/zerolog/log"
-
 	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
 
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -34,8 +31,6 @@ func TryParseResponseAsFocusJSON(jsonData []byte) ([]byte, error) {
 	var focusConfigList finopsdatatypes.FocusConfigList
 	err := json.Unmarshal(jsonData, &focusConfigList)
 	if err != nil {
-		log.Logger.Warn().Err(err).Msg("Parsing failed")
-		//log.Logger.Info().Msg(string(jsonData))
 		return []byte{}, err
 	}
 
@@ -45,24 +40,28 @@ func TryParseResponseAsFocusJSON(jsonData []byte) ([]byte, error) {
 }
 
 func GetOutputStr(configList finopsdatatypes.FocusConfigList) string {
-	outputStr := ""
+	var buf bytes.Buffer
+	// Values can contain commas and quotes (e.g. descriptions and tags), so they are CSV-quoted
+	writer := csv.NewWriter(&buf)
 	for i, config := range configList.Items {
 		v := reflect.ValueOf(config.Spec.FocusSpec)
 
 		if i == 0 {
+			header := make([]string, v.NumField())
 			for i := 0; i < v.NumField(); i++ {
-				outputStr += v.Type().Field(i).Name + ","
+				header[i] = v.Type().Field(i).Name
 			}
-			outputStr = strings.TrimSuffix(outputStr, ",") + "\n"
+			writer.Write(header)
 		}
 
+		record := make([]string, v.NumField())
 		for i := 0; i < v.NumField(); i++ {
-			outputStr += GetStringValue(v.Field(i).Interface()) + ","
+			record[i] = GetStringValue(v.Field(i).Interface())
 		}
-		outputStr = strings.TrimSuffix(outputStr, ",") + "\n"
+		writer.Write(record)
 	}
-	outputStr = strings.TrimSuffix(outputStr, "\n")
-	log.Logger.Info().Msg(outputStr)
+	writer.Flush()
+	outputStr := strings.TrimSuffix(buf.String(), "\n")
 	return outputStr
 }
 
@@ -94,11 +93,16 @@ func GetStringValue(value any) string {
 
 	tags, ok := value.([]finopsdatatypes.TagsType)
 	if ok {
-		res := ""
+		if len(tags) == 0 {
+			return ""
+		}
+		res := map[string]string{}
 		for _, tag := range tags {
-			res += tag.Key + "=" + tag.Value + ";"
+			res[tag.Key] = tag.Value
 		}
-		return strings.TrimSuffix(res, ";")
+		// Tags columns are JSON objects, as in FOCUS reports
+		data, _ := json.Marshal(res)
+		return string(data)
 	}
 
 	return ""
@@ -111,7 +115,6 @@ func GetStringValue(value any) string {
 * @return the index of the "toFind" column
  */
 func GetIndexOf(records [][]string, toFind string) (int, error) {
-	log.Debug().Msgf("Looking for %s", toFind)
 	if len(records) > 0 {
 		for i, value := range records[0] {
 			if strings.EqualFold(value, toFind) {
@@ -137,31 +140,3 @@ func GetClientSet() (*kubernetes.Clientset, error) {
 	}
 	return clientset, nil
 }
-
-// replaceVariables replaces all variables in the format <variable> with their values
-// from the additionalVariables map or from environment variables if the variable name is uppercase
-func ReplaceVariables(text string, additionalVariables map[string]string) string {
-	regex, _ := regexp.Compile("<.*?>")
-	toReplaceRange := regex.FindStringIndex(text)
-
-	for toReplaceRange != nil {
-		// Extract variable name without the < > brackets
-		varName := text[toReplaceRange[0]+1 : toReplaceRange[1]-1]
-
-		// Get replacement value from additionalVariables
-		varToReplace := additionalVariables[varName]
-
-		// If the variable name is all uppercase, get value from environment
-		if varToReplace == strings.ToUpper(varToReplace) {
-			varToReplace = os.Getenv(varToReplace)
-		}
-
-		// Replace the variable in the text
-		text = strings.Replace(text, text[toReplaceRange[0]:toReplaceRange[1]], varToReplace, -1)
-
-		// Find next variable
-		toReplaceRange = regex.FindStringIndex(text)
-	}
-
-	return text
-}
@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxVariableDepth bounds the resolution of variables whose value contains other variables.
+const maxVariableDepth = 10
+
+// variableNameRegex matches the content of a variable, <name> or <name|default>. Anything
+// else between angle brackets (e.g. a comparison in a payload) is left as it is.
+var variableNameRegex = regexp.MustCompile(`^((?:env:)?[A-Za-z_][A-Za-z0-9_.\-]*)(?:\|(.*))?$`)
+
+// legacyEnvRegex matches the values that were looked up in the environment before the env: prefix.
+var legacyEnvRegex = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
+// ReplaceOptions controls how ReplaceVariables resolves and substitutes the variables.
+type ReplaceOptions struct {
+	// Lookup, if set, resolves variables before the additional variables (e.g. TimeVariablesLookup).
+	Lookup func(name string) (string, bool)
+	// URLEncode encodes the values as path segments, or as query values after the '?'.
+	URLEncode bool
+	// LegacyEnvLookup reads the additional variables whose value is an uppercase name from the environment.
+	LegacyEnvLookup bool
+	// EscapeTemplates escapes the actions in the values, for texts rendered as Go templates afterwards,
+	// so that a value is never executed as a template.
+	EscapeTemplates bool
+}
+
+// UnresolvedVariablesError lists the variables that have neither a value nor a default.
+type UnresolvedVariablesError struct {
+	Names []string
+}
+
+func (e *UnresolvedVariablesError) Error() string {
+	return fmt.Sprintf("unresolved variables: %s", strings.Join(e.Names, ", "))
+}
+
+/*
+* Replaces all variables in the format <variable> with their values.
+* A variable is resolved, in order, from the environment if it has the env: prefix (<env:NAME>), from the lookup of the options and
+* from the additional variables; <variable|default> falls back to the default value. Additional variables whose value has the
+* env: prefix are read from the environment (or, with LegacyEnvLookup, whose value is an uppercase name), and their value can
+* contain other variables.
+* Literal angle brackets are escaped as \< and \>.
+* @param text The text to replace the variables in
+* @param additionalVariables The additional variables of the exporter config
+* @param opts The lookup and encoding options
+* @return the text with the variables replaced, and an UnresolvedVariablesError if any variable could not be resolved
+ */
+func ReplaceVariables(text string, additionalVariables map[string]string, opts ReplaceOptions) (string, error) {
+	unresolved := map[string]bool{}
+	res, err := replaceVariables(text, additionalVariables, opts, 0, unresolved)
+	if err != nil {
+		return text, err
+	}
+
+	if len(unresolved) > 0 {
+		names := make([]string, 0, len(unresolved))
+		for name := range unresolved {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return res, &UnresolvedVariablesError{Names: names}
+	}
+	return res, nil
+}
+
+func replaceVariables(text string, additionalVariables map[string]string, opts ReplaceOptions, depth int, unresolved map[string]bool) (string, error) {
+	if depth > maxVariableDepth {
+		return text, fmt.Errorf("variables nested more than %d levels deep in %q", maxVariableDepth, text)
+	}
+
+	var sb strings.Builder
+	inQuery := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+
+		if c == '\\' && i+1 < len(text) && (text[i+1] == '<' || text[i+1] == '>') {
+			sb.WriteByte(text[i+1])
+			i++
+			continue
+		}
+
+		end := strings.IndexByte(text[i+1:], '>')
+		if c != '<' || end < 0 {
+			if c == '?' {
+				inQuery = true
+			}
+			sb.WriteByte(c)
+			continue
+		}
+
+		match := variableNameRegex.FindStringSubmatch(text[i+1 : i+1+end])
+		if match == nil {
+			sb.WriteByte(c)
+			continue
+		}
+
+		value, ok, err := resolveVariable(match[1], additionalVariables, opts, depth, unresolved)
+		if err != nil {
+			return text, err
+		}
+		if !ok {
+			if !strings.Contains(match[0], "|") {
+				unresolved[match[1]] = true
+				sb.WriteString(text[i : i+end+2])
+				i += end + 1
+				continue
+			}
+			value = match[2]
+		}
+
+		if opts.URLEncode {
+			value = urlEncode(value, inQuery)
+		}
+		if opts.EscapeTemplates && ok {
+			value = strings.ReplaceAll(value, "{{", `{{"{{"}}`)
+		}
+		sb.WriteString(value)
+		i += end + 1
+	}
+
+	return sb.String(), nil
+}
+
+func resolveVariable(name string, additionalVariables map[string]string, opts ReplaceOptions, depth int, unresolved map[string]bool) (string, bool, error) {
+	if envName, ok := strings.CutPrefix(name, "env:"); ok {
+		value, ok := os.LookupEnv(envName)
+		return value, ok, nil
+	}
+
+	if opts.Lookup != nil {
+		if value, ok := opts.Lookup(name); ok {
+			return value, true, nil
+		}
+	}
+
+	value, ok := additionalVariables[name]
+	if !ok {
+		return "", false, nil
+	}
+
+	if envName, ok := strings.CutPrefix(value, "env:"); ok {
+		value, ok := os.LookupEnv(envName)
+		return value, ok, nil
+	}
+
+	// Deprecated: uppercase values used to be environment variable names, only with the opt-in
+	if opts.LegacyEnvLookup && legacyEnvRegex.MatchString(value) {
+		if envValue, ok := os.LookupEnv(value); ok {
+			return envValue, true, nil
+		}
+	}
+
+	// The value can reference other variables, it is encoded once it is fully resolved
+	nested := opts
+	nested.URLEncode = false
+	nested.EscapeTemplates = false
+	value, err := replaceVariables(value, additionalVariables, nested, depth+1, unresolved)
+	return value, true, err
+}
+
+// urlEncode escapes a value as query value, or as path segments keeping the slashes.
+func urlEncode(value string, inQuery bool) string {
+	if inQuery {
+		return url.QueryEscape(value)
+	}
+
+	segments := strings.Split(value, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
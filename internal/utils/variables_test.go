@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReplaceVariables(t *testing.T) {
+	t.Setenv("FINOPS_TEST_TOKEN", "s3cr3t")
+
+	lookup := func(name string) (string, bool) {
+		if name == "StartDate" {
+			return "2025-01-01", true
+		}
+		return "", false
+	}
+
+	tests := []struct {
+		name       string
+		text       string
+		variables  map[string]string
+		opts       ReplaceOptions
+		want       string
+		unresolved []string
+		wantErr    string
+	}{
+		{
+			name:      "additional variable",
+			text:      "/subscriptions/<subscription>/costs",
+			variables: map[string]string{"subscription": "1234"},
+			want:      "/subscriptions/1234/costs",
+		},
+		{
+			name:      "escaped angle brackets",
+			text:      `\<subscription\> is <subscription>, \<b\>`,
+			variables: map[string]string{"subscription": "1234"},
+			want:      "<subscription> is 1234, <b>",
+		},
+		{
+			name: "text between angle brackets",
+			text: "a<b and c>d, x < 3, y > 2, <1abc>, <a b|c>",
+			want: "a<b and c>d, x < 3, y > 2, <1abc>, <a b|c>",
+		},
+		{
+			name: "unclosed angle bracket",
+			text: "a <b",
+			want: "a <b",
+		},
+		{
+			name: "defaults",
+			text: "<a|1>-<b|>-<c|x|y>",
+			want: "1--x|y",
+		},
+		{
+			name: "defaults url encoded in the path and in the query",
+			text: "/costs/<scope|a b/c>?filter=<filter|x&y z>&scope=<scope|a/b>",
+			opts: ReplaceOptions{URLEncode: true},
+			want: "/costs/a%20b/c?filter=x%26y+z&scope=a%2Fb",
+		},
+		{
+			name:      "values url encoded in the path and in the query",
+			text:      "/<scope>/costs?scope=<scope>",
+			variables: map[string]string{"scope": "rg 1/vm?1"},
+			opts:      ReplaceOptions{URLEncode: true},
+			want:      "/rg%201/vm%3F1/costs?scope=rg+1%2Fvm%3F1",
+		},
+		{
+			name:      "nested variables",
+			text:      "/<scope>",
+			variables: map[string]string{"sub": "a b", "scope": "subscriptions/<sub>"},
+			opts:      ReplaceOptions{URLEncode: true},
+			want:      "/subscriptions/a%20b",
+		},
+		{
+			name:      "lookup first",
+			text:      "<StartDate> <EndDate|none>",
+			variables: map[string]string{"StartDate": "ignored"},
+			opts:      ReplaceOptions{Lookup: lookup},
+			want:      "2025-01-01 none",
+		},
+		{
+			name:      "env prefix",
+			text:      "<env:FINOPS_TEST_TOKEN> <token> <env:FINOPS_TEST_MISSING|unset>",
+			variables: map[string]string{"token": "env:FINOPS_TEST_TOKEN"},
+			want:      "s3cr3t s3cr3t unset",
+		},
+		{
+			name:      "uppercase value without the legacy lookup",
+			text:      "<token>",
+			variables: map[string]string{"token": "FINOPS_TEST_TOKEN"},
+			want:      "FINOPS_TEST_TOKEN",
+		},
+		{
+			name:      "uppercase value with the legacy lookup",
+			text:      "<token> <region>",
+			variables: map[string]string{"token": "FINOPS_TEST_TOKEN", "region": "EU_WEST"},
+			opts:      ReplaceOptions{LegacyEnvLookup: true},
+			want:      "s3cr3t EU_WEST",
+		},
+		{
+			name:      "escaped templates",
+			text:      `{"filter": "<filter>", "default": "<missing|{{.x}}>"}`,
+			variables: map[string]string{"filter": "{{.secret}}"},
+			opts:      ReplaceOptions{EscapeTemplates: true},
+			want:      `{"filter": "{{"{{"}}.secret}}", "default": "{{.x}}"}`,
+		},
+		{
+			name:       "unresolved variables",
+			text:       "<b>/<a>/<c|ok>/<b>/<nested>",
+			variables:  map[string]string{"nested": "<d>"},
+			want:       "<b>/<a>/ok/<b>/<d>",
+			unresolved: []string{"a", "b", "d"},
+		},
+		{
+			name:      "self reference",
+			text:      "<loop>",
+			variables: map[string]string{"loop": "x<loop>"},
+			wantErr:   "nested more than 10 levels deep",
+		},
+		{
+			name:      "mutual reference",
+			text:      "<a>",
+			variables: map[string]string{"a": "<b>", "b": "<a>"},
+			wantErr:   "nested more than 10 levels deep",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReplaceVariables(tt.text, tt.variables, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				if got != tt.text {
+					t.Errorf("got %q, want the text unchanged", got)
+				}
+				return
+			}
+
+			var unresolvedErr *UnresolvedVariablesError
+			if len(tt.unresolved) > 0 {
+				if !errors.As(err, &unresolvedErr) {
+					t.Fatalf("error = %v, want unresolved variables %v", err, tt.unresolved)
+				}
+				if !reflect.DeepEqual(unresolvedErr.Names, tt.unresolved) {
+					t.Errorf("unresolved variables %v, want %v", unresolvedErr.Names, tt.unresolved)
+				}
+				if want := "unresolved variables: " + strings.Join(tt.unresolved, ", "); err.Error() != want {
+					t.Errorf("error %q, want %q", err.Error(), want)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
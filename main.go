@@ -1,297 +1,138 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/csv"
-	"encoding/json"
-	"io"
+	"net"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/krateoplatformops/finops-prometheus-exporter-generic/internal/utils"
-	"k8s.io/client-go/rest"
-
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
-	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 
-	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
-	configmetrics "github.com/krateoplatformops/finops-prometheus-exporter-generic/internal/config"
 	"github.com/krateoplatformops/finops-prometheus-exporter-generic/internal/helpers/kube/endpoints"
-	"github.com/krateoplatformops/finops-prometheus-exporter-generic/internal/helpers/kube/httpcall"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/exporter"
 )
 
-type recordGaugeCombo struct {
-	record        []string
-	gauge         prometheus.Gauge
-	thisIteration bool
-}
-
-func ParseConfigFile(file string) (finopsdatatypes.ExporterScraperConfig, *httpcall.Endpoint, error) {
-	fileReader, err := os.OpenFile(file, os.O_RDONLY, 0600)
-	if err != nil {
-		return finopsdatatypes.ExporterScraperConfig{}, &httpcall.Endpoint{}, err
-	}
-	defer fileReader.Close()
-	data, err := io.ReadAll(fileReader)
-	if err != nil {
-		return finopsdatatypes.ExporterScraperConfig{}, &httpcall.Endpoint{}, err
-	}
-
-	parse := finopsdatatypes.ExporterScraperConfig{}
-
-	err = yaml.Unmarshal(data, &parse)
-	if err != nil {
-		return finopsdatatypes.ExporterScraperConfig{}, &httpcall.Endpoint{}, err
+func main() {
+	username, groups, authNS := endpoints.ImpersonationFromEnv()
+	opts := exporter.Options{
+		Username:      username,
+		Groups:        groups,
+		AuthNamespace: authNS,
+		SnapshotFile:  os.Getenv("SNAPSHOT_FILE"),
 	}
 
-	rc, _ := rest.InClusterConfig()
-	endpoint, err := endpoints.Resolve(context.Background(), endpoints.ResolveOptions{
-		RESTConfig: rc,
-		API:        &parse.Spec.ExporterConfig.API,
-	})
-	if err != nil {
-		return finopsdatatypes.ExporterScraperConfig{}, &httpcall.Endpoint{}, err
+	// POST /-/refresh is enabled by its bearer token
+	if token := os.Getenv("REFRESH_TOKEN"); token != "" {
+		opts.Refresh = &exporter.RefreshOptions{Token: token}
 	}
-
-	// Replace variables in server URL
-	endpoint.ServerURL = utils.ReplaceVariables(endpoint.ServerURL, parse.Spec.ExporterConfig.AdditionalVariables)
-
-	// Replace variables in API path
-	parse.Spec.ExporterConfig.API.Path = utils.ReplaceVariables(parse.Spec.ExporterConfig.API.Path, parse.Spec.ExporterConfig.AdditionalVariables)
-
-	return parse, endpoint, nil
-}
-
-func makeAPIRequest(config finopsdatatypes.ExporterScraperConfig, endpoint *httpcall.Endpoint) []byte {
-	res := &http.Response{StatusCode: 500}
-	var err_call error
-	firstIteration := true
-	for ok := true; ok; ok = (firstIteration || err_call != nil || res.StatusCode != 200) {
-		firstIteration = false
-
-		httpClient, err := httpcall.HTTPClientForEndpoint(endpoint)
+	if minAge := os.Getenv("REFRESH_ON_SCRAPE_MIN_AGE"); minAge != "" {
+		d, err := time.ParseDuration(minAge)
 		if err != nil {
-			log.Logger.Warn().Err(err).Msg("error while creating HTTP client")
+			log.Logger.Fatal().Err(err).Msg("error while parsing REFRESH_ON_SCRAPE_MIN_AGE")
 		}
-
-		res, err_call = httpcall.Do(context.TODO(), httpClient, httpcall.Options{
-			API:      &config.Spec.ExporterConfig.API,
-			Endpoint: endpoint,
-		})
-
-		if err_call == nil && res.StatusCode != 200 {
-			log.Warn().Msgf("Received status code %d", res.StatusCode)
-			bodyData, _ := io.ReadAll(res.Body)
-			log.Warn().Msgf("Body %s", string(bodyData))
-		} else {
-			log.Logger.Warn().Err(err_call).Msg("error occurred while making API call")
+		if opts.Refresh == nil {
+			opts.Refresh = &exporter.RefreshOptions{}
 		}
-		log.Logger.Warn().Msgf("Retrying connection in 5s...")
-		time.Sleep(5 * time.Second)
-
-		log.Logger.Info().Msgf("Parsing Endpoint again...")
-		rc, _ := rest.InClusterConfig()
-		endpoint, err = endpoints.Resolve(context.Background(), endpoints.ResolveOptions{
-			RESTConfig: rc,
-			API:        &config.Spec.ExporterConfig.API,
-		})
-		if err != nil {
-			continue
-		}
-		endpoint.ServerURL = utils.ReplaceVariables(endpoint.ServerURL, config.Spec.ExporterConfig.AdditionalVariables)
+		opts.Refresh.ScrapeMinAge = d
 	}
 
-	defer res.Body.Close()
-
-	data, err := io.ReadAll(res.Body)
-	if err != nil {
-		log.Logger.Warn().Err(err).Msg("an error has occured while reading response body")
+	// The ExporterScraperConfig is watched if selected, otherwise the mounted file is read again before every scrape
+	watch := exporter.WatchOptions{
+		Namespace:     os.Getenv("WATCH_CONFIG_NAMESPACE"),
+		Name:          os.Getenv("WATCH_CONFIG_NAME"),
+		LabelSelector: os.Getenv("WATCH_CONFIG_LABEL_SELECTOR"),
 	}
-
-	// "Content-Encoding: gzip" is automatically handlded by go's HTTP transport
-	log.Logger.Debug().Msgf("Content-Type: %s", strings.ToLower(res.Header.Get("Content-Type")))
-	log.Logger.Debug().Msgf("Content-Length: %s", strings.ToLower(res.Header.Get("Content-Length")))
-
-	if strings.ToLower(res.Header.Get("Content-Type")) == "application/json" {
-		log.Logger.Info().Msg("Detected json content-type")
-		jsonDataParsed, err := utils.TryParseResponseAsFocusJSON(utils.TrapBOM(data))
-		if err != nil {
-			log.Logger.Warn().Err(err).Msg("an error has occured while parsing json data")
+	if watch.Name == "" && watch.LabelSelector == "" {
+		opts.Reload = func() (exporter.Config, error) {
+			return exporter.LoadConfigFile("/config/config.yaml")
 		}
-		return jsonDataParsed
-	} else if strings.ToLower(res.Header.Get("Content-Type")) == "text/csv" {
-		return utils.TrapBOM(data)
 	}
-	log.Logger.Error().Msgf("Content-Type not supported: %s", strings.ToLower(res.Header.Get("Content-Type")))
-	return nil
-}
-
-func getFOCUSRecordsFromFile(data []byte) [][]string {
-	reader := csv.NewReader(bytes.NewReader(data))
-	reader.LazyQuotes = true
+	reportStatus := strings.EqualFold(os.Getenv("REPORT_STATUS"), "true")
+	leaseName := os.Getenv("LEADER_ELECTION_LEASE_NAME")
 
-	records, err := reader.ReadAll()
-	if err != nil {
-		log.Logger.Warn().Err(err).Msg("error while reading file")
-		return nil
-	}
-
-	return records
-}
-
-func getUsageRecordsFromFile(byteData []byte, config finopsdatatypes.ExporterScraperConfig) [][]string {
-	data := configmetrics.Metrics{}
-	err := json.Unmarshal(byteData, &data)
-	if err != nil {
-		log.Logger.Error().Err(err).Msg("error decoding response")
-		if e, ok := err.(*json.SyntaxError); ok {
-			log.Logger.Error().Msgf("syntax error at byte offset %d", e.Offset)
+	var dynamicClient dynamic.Interface
+	if opts.Reload == nil || reportStatus || leaseName != "" {
+		rc, err := rest.InClusterConfig()
+		if err != nil {
+			log.Logger.Fatal().Err(err).Msg("error while loading the in-cluster configuration")
 		}
-		log.Logger.Info().Msgf("response: %q", byteData)
-		log.Logger.Error().Err(err).Msg("error while reading file")
-		return nil
-	}
-
-	stringCSV := "ResourceId,metricName,timestamp,average,unit\n"
-	for _, value := range data.Value {
-		for _, timeseries := range value.Timeseries {
-			for _, metric := range timeseries.Data {
-				stringCSV += config.Spec.ExporterConfig.AdditionalVariables["ResourceId"] + "," + value.Name.Value + "," + metric.Timestamp.Format(time.RFC3339) + "," + metric.Average.AsDec().String() + "," + value.Unit + "\n"
-			}
+		dynamicClient, err = dynamic.NewForConfig(rc)
+		if err != nil {
+			log.Logger.Fatal().Err(err).Msg("error while creating the dynamic client")
 		}
-	}
-
-	stringCSV = strings.TrimSuffix(stringCSV, "\n")
-
-	reader := csv.NewReader(strings.NewReader(stringCSV))
-
-	records, err := reader.ReadAll()
-	if err != nil {
-		log.Logger.Error().Err(err).Msg("error while reading file")
-		return nil
-	}
-
-	return records
-}
 
-func updatedMetrics(registry *prometheus.Registry, prometheusMetrics map[string]recordGaugeCombo) {
-	for {
-		config, endpoint, err := ParseConfigFile("/config/config.yaml")
+		clientset, err := kubernetes.NewForConfig(rc)
 		if err != nil {
-			log.Logger.Error().Err(err).Msg("error while parsing configuration, trying again in 5s...")
-			time.Sleep(5 * time.Second)
-			continue
+			log.Logger.Fatal().Err(err).Msg("error while creating the clientset")
 		}
-		data := makeAPIRequest(config, endpoint)
-		var records [][]string
-		if strings.ToLower(config.Spec.ExporterConfig.MetricType) == "cost" {
-			records = getFOCUSRecordsFromFile(data)
-		} else if strings.ToLower(config.Spec.ExporterConfig.MetricType) == "resource" {
-			records = getUsageRecordsFromFile(data, config)
-		} else {
-			log.Logger.Error().Err(err).Msgf("Unknow metric type: %s, trying again in 5s...", config.Spec.ExporterConfig.MetricType)
-			time.Sleep(5 * time.Second)
-			continue
-		}
-
-		// Obtain various indexes
-		// BilledCost for value of metric
-		valueIndex := -1
-		if strings.ToLower(config.Spec.ExporterConfig.MetricType) == "cost" {
-			valueIndex, err = utils.GetIndexOf(records, "BilledCost")
-			if err != nil {
-				log.Logger.Warn().Err(err).Msg("error while selecting column BilledCost, retrying...")
-				time.Sleep(5 * time.Second)
-				continue
-			}
-		} else if strings.ToLower(config.Spec.ExporterConfig.MetricType) == "resource" {
-			valueIndex = 3
-		} // There is no else here, because we cannot arrive here if we get the else condition from the same test above
 
-		notFound := true
-		log.Info().Msgf("Analyzing %d records...", len(records))
-		for i, record := range records {
-			// Skip header line
-			if i == 0 {
-				continue
+		if reportStatus {
+			broadcaster := record.NewBroadcaster()
+			broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+			opts.Status = &exporter.StatusOptions{
+				Client:   dynamicClient,
+				Recorder: broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "finops-prometheus-exporter-generic"}),
+				// The configuration file does not identify the resource, the watched resource does
+				Namespace: os.Getenv("STATUS_CONFIG_NAMESPACE"),
+				Name:      os.Getenv("STATUS_CONFIG_NAME"),
 			}
+		}
 
-			notFound = true
-			if _, ok := prometheusMetrics[strings.Join(record, " ")]; ok {
-				metricValue, err := strconv.ParseFloat(record[valueIndex], 64)
-				if err != nil {
-					log.Logger.Warn().Err(err).Msgf("skipping this record for this iteration, error while parsing metric value: %s", record[valueIndex])
-					continue
-				}
-				gaugeObj := prometheusMetrics[strings.Join(record, " ")]
-				gaugeObj.gauge.Set(metricValue)
-				gaugeObj.thisIteration = true
-				prometheusMetrics[strings.Join(record, " ")] = gaugeObj
-				notFound = false
+		// Only the leader of the replicas scrapes, the followers export its snapshot
+		if leaseName != "" {
+			namespace := os.Getenv("LEADER_ELECTION_NAMESPACE")
+			if namespace == "" {
+				namespace = os.Getenv("POD_NAMESPACE")
 			}
-
-			if notFound {
-				labels := prometheus.Labels{}
-				for j, value := range record {
-					if strings.ToLower(config.Spec.ExporterConfig.MetricType) == "cost" && strings.Contains(records[0][j], "x_") {
-						continue
-					}
-					if !strings.Contains(records[0][j], "Tags") {
-						labels[records[0][j]] = value
-					} else {
-						replacer := strings.NewReplacer("{", "", "}", "", "=", ":", ",", ";", "\"", "")
-						labels[records[0][j]] = replacer.Replace(value)
-					}
-				}
-
-				name := ""
-				if strings.ToLower(config.Spec.ExporterConfig.MetricType) == "cost" {
-					name = "billed_cost"
-				} else if strings.ToLower(config.Spec.ExporterConfig.MetricType) == "resource" {
-					name = strings.ReplaceAll(strings.ToLower(labels[records[0][1]]), " ", "_")
-				}
-				newMetricsRow := promauto.NewGauge(prometheus.GaugeOpts{
-					Name:        name,
-					ConstLabels: labels,
-				})
-				metricValue, err := strconv.ParseFloat(records[i][valueIndex], 64)
-				if err != nil {
-					log.Logger.Warn().Err(err).Msgf("skipping this record for this iteration, error while parsing metric value: %s", records[i][valueIndex])
-					continue
-				}
-				newMetricsRow.Set(metricValue)
-				prometheusMetrics[strings.Join(record, " ")] = recordGaugeCombo{record: record, gauge: newMetricsRow, thisIteration: true}
-				registry.MustRegister(newMetricsRow)
+			opts.LeaderElection = &exporter.LeaderElectionOptions{
+				Client:    clientset,
+				Namespace: namespace,
+				Name:      leaseName,
+				Identity:  os.Getenv("POD_NAME"),
+				// The followers read the snapshot of the leader with the token shared by the replicas
+				SnapshotToken: os.Getenv("LEADER_ELECTION_SNAPSHOT_TOKEN"),
 			}
-		}
-
-		for key, gaugeObj := range prometheusMetrics {
-			if !gaugeObj.thisIteration {
-				registry.Unregister(gaugeObj.gauge)
-				delete(prometheusMetrics, key)
-			} else {
-				gaugeObj.thisIteration = false
-				prometheusMetrics[key] = gaugeObj
+			podIP := os.Getenv("POD_IP")
+			if podIP == "" {
+				log.Logger.Fatal().Msg("leader election requires POD_IP, the address the followers read the snapshot of the leader from")
 			}
+			opts.LeaderElection.Address = net.JoinHostPort(podIP, "2112")
 		}
-		log.Debug().Msgf("Polling interval set to %s, starting sleep...", config.Spec.ExporterConfig.PollingInterval.Duration.String())
-		time.Sleep(config.Spec.ExporterConfig.PollingInterval.Duration)
 	}
-}
 
-func main() {
-	registry := prometheus.NewRegistry()
-	go updatedMetrics(registry, map[string]recordGaugeCombo{})
+	e, err := exporter.New(exporter.Config{}, opts)
+	if err != nil {
+		log.Logger.Fatal().Err(err).Msg("error while creating the exporter")
+	}
 
-	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	if opts.Reload == nil {
+		watch.Client = dynamicClient
+		go func() {
+			if err := e.Watch(context.Background(), watch); err != nil {
+				log.Logger.Fatal().Err(err).Msg("error while watching the ExporterScraperConfig")
+			}
+		}()
+	}
+	go func() {
+		if err := e.Run(context.Background()); err != nil {
+			log.Logger.Fatal().Err(err).Msg("error while running the exporter")
+		}
+	}()
 
-	http.Handle("/metrics", handler)
+	http.Handle("/metrics", e.Handler())
+	http.Handle("/metrics/backfill", e.BackfillHandler())
+	if opts.LeaderElection != nil {
+		http.Handle("/-/snapshot", e.SnapshotHandler())
+	}
+	http.Handle("/-/refresh", e.RefreshHandler())
 	http.ListenAndServe(":2112", nil)
 }
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Exporter holds the exporter settings that are not part of the ExporterScraperConfig
+// CRD. They are read from the same configuration file, under spec.exporterConfig.
+type Exporter struct {
+	HTTP       HTTP       `yaml:"http"`
+	Debug      Debug      `yaml:"debug"`
+	TimeWindow TimeWindow `yaml:"timeWindow"`
+	FanOut     FanOut     `yaml:"fanOut"`
+	Mapping    Mapping    `yaml:"mapping"`
+	Series     Series     `yaml:"series"`
+	Schedule   Schedule   `yaml:"schedule"`
+	// LegacyEnvLookup reads the additional variables whose value is made only of uppercase letters,
+	// digits and underscores from the environment, as before the env: prefix.
+	LegacyEnvLookup bool `yaml:"legacyEnvLookup"`
+}
+
+// HTTP tunes the client used to call the endpoint, zero values keep the defaults.
+type HTTP struct {
+	Timeout               time.Duration `yaml:"timeout"`
+	DialTimeout           time.Duration `yaml:"dialTimeout"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tlsHandshakeTimeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"responseHeaderTimeout"`
+	IdleConnTimeout       time.Duration `yaml:"idleConnTimeout"`
+	MaxIdleConns          int           `yaml:"maxIdleConns"`
+	MaxIdleConnsPerHost   int           `yaml:"maxIdleConnsPerHost"`
+	MaxConnsPerHost       int           `yaml:"maxConnsPerHost"`
+	DisableHTTP2          bool          `yaml:"disableHTTP2"`
+	// ConditionalRequests sends back the ETag and Last-Modified of the last response, a 304 keeps the exported series.
+	ConditionalRequests bool `yaml:"conditionalRequests"`
+	// SkipUnchanged keeps the exported series when the content hash of the body is unchanged.
+	SkipUnchanged bool `yaml:"skipUnchanged"`
+	// RateLimit limits the requests to the endpoint.
+	RateLimit RateLimit `yaml:"rateLimit"`
+}
+
+// RateLimit configures the token bucket of the requests to the endpoint, zero values keep the defaults.
+type RateLimit struct {
+	// QPS is the steady rate of requests per second (no limit by default).
+	QPS float64 `yaml:"qps"`
+	// Burst is the number of requests sent at once above the steady rate (1 by default).
+	Burst int `yaml:"burst"`
+	// MinRemaining is the remaining quota reported by Azure below which the rate slows down (10 by default).
+	MinRemaining int `yaml:"minRemaining"`
+}
+
+// Schedule sets the start times of the scrapes. By default the polling interval is slept after each scrape.
+type Schedule struct {
+	// Cron is a cron expression with five fields (minute, hour, day of month, month and day of week)
+	// or a descriptor such as @hourly, it replaces the polling interval.
+	Cron string `yaml:"cron"`
+	// Align starts the scrapes on the multiples of the polling interval, e.g. on the hour with 1h.
+	Align bool `yaml:"align"`
+	// Offset shifts the aligned start times, e.g. 5m past the hour.
+	Offset time.Duration `yaml:"offset"`
+	// Jitter delays each scrape by a random duration up to Jitter.
+	Jitter time.Duration `yaml:"jitter"`
+	// Timezone is the IANA name of the timezone of the cron expression and of the alignment (UTC by default).
+	Timezone string `yaml:"timezone"`
+}
+
+// Debug configures the logging of the requests and responses exchanged with the endpoint.
+type Debug struct {
+	// Enabled turns on the request logging, as the debug key of the endpoint Secret does.
+	Enabled bool `yaml:"enabled"`
+	// RedactHeaders are added to the headers whose value is never logged.
+	RedactHeaders []string `yaml:"redactHeaders"`
+	// RedactFields are added to the body fields and query parameters whose value is never logged.
+	RedactFields []string `yaml:"redactFields"`
+	// MaxBodySize is the number of body bytes logged, 0 for the default.
+	MaxBodySize int `yaml:"maxBodySize"`
+}
+
+// TimeWindow configures the time window variables (e.g. <billingPeriodStart>) of the requests.
+type TimeWindow struct {
+	// Timezone is the IANA name of the timezone of the variables (UTC by default).
+	Timezone string `yaml:"timezone"`
+	// Format is rfc3339 (default), date, unix, unixMilli or a Go time layout.
+	Format string `yaml:"format"`
+	// Formats overrides Format for single variables.
+	Formats map[string]string `yaml:"formats"`
+	// BillingPeriodStartDay is the day of the month billing periods start on (1 by default).
+	BillingPeriodStartDay int `yaml:"billingPeriodStartDay"`
+	// InitialLookback is used for lastScrapeTime before the first successful scrape (24h by default).
+	InitialLookback time.Duration `yaml:"initialLookback"`
+}
+
+// FanOut executes one request per variable set, the variable sets override the additional
+// variables and their values are added to the records as labels.
+type FanOut struct {
+	// VariableSets are static variable sets.
+	VariableSets []map[string]string `yaml:"variableSets"`
+	// ConfigMapSelector adds the data of each selected ConfigMap as variable set.
+	ConfigMapSelector *ConfigMapSelector `yaml:"configMapSelector"`
+	// Concurrency is the maximum number of concurrent requests (4 by default).
+	Concurrency int `yaml:"concurrency"`
+	// MaxAttempts is the number of attempts of each request before its variable set is skipped (3 by default).
+	MaxAttempts int `yaml:"maxAttempts"`
+}
+
+type ConfigMapSelector struct {
+	// Namespace is the namespace of the ConfigMaps (the auth namespace by default), required without an auth namespace.
+	Namespace     string `yaml:"namespace"`
+	LabelSelector string `yaml:"labelSelector"`
+}
+
+// Mapping turns an arbitrary JSON response into records, for the json metric type.
+// Paths use the kubectl JSONPath syntax, with or without the enclosing braces.
+type Mapping struct {
+	// Rows selects the rows of the response, e.g. {.value[*]}.
+	Rows string `yaml:"rows"`
+	// Columns are evaluated against each row, or against the whole response if their path starts with $.
+	Columns []MappingColumn `yaml:"columns"`
+	// ValueColumn is the name of the column holding the metric value.
+	ValueColumn string `yaml:"valueColumn"`
+	// MetricName is the name of the exported metric.
+	MetricName string `yaml:"metricName"`
+}
+
+type MappingColumn struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+}
+
+// Series controls the names and labels of the exported series.
+type Series struct {
+	// Namespace is prepended to the metric names, separated by an underscore.
+	Namespace string `yaml:"namespace"`
+	// NameTemplate is a Go template of the metric name, with .name (the default name) and .labels.
+	NameTemplate string `yaml:"nameTemplate"`
+	// SnakeCaseLabels converts the column names to snake case label names, e.g. BilledCost to billed_cost.
+	SnakeCaseLabels bool `yaml:"snakeCaseLabels"`
+	// ExposeLabelMapping exports the columns renamed to be valid label names as an info metric.
+	ExposeLabelMapping bool `yaml:"exposeLabelMapping"`
+	// Tags expands the Tags columns into one label per tag.
+	Tags Tags `yaml:"tags"`
+	// RelabelConfigs are applied in order to the labels of every series, with the metric name as __name__.
+	RelabelConfigs []RelabelConfig `yaml:"relabelConfigs"`
+	// Timestamp exports a column as the timestamp of the samples instead of a label.
+	Timestamp Timestamp `yaml:"timestamp"`
+}
+
+// Timestamp turns a time column of the records into the sample timestamp.
+type Timestamp struct {
+	// Column is the column holding the sample timestamp, e.g. ChargePeriodStart.
+	Column string `yaml:"column"`
+	// Layout is rfc3339 (default), date, unix, unixMilli or a Go time layout.
+	Layout string `yaml:"layout"`
+	// DropColumns are other time columns removed from the labels, e.g. ChargePeriodEnd.
+	DropColumns []string `yaml:"dropColumns"`
+	// Backfill exposes every record with its own timestamp on /metrics/backfill, in the OpenMetrics format.
+	Backfill bool `yaml:"backfill"`
+}
+
+// Tags controls the expansion of the tags, parsed from JSON objects or key=value pairs.
+type Tags struct {
+	// Expand adds a label for each tag, e.g. tag_team.
+	Expand bool `yaml:"expand"`
+	// Columns are the tags columns (the columns whose name contains Tags by default).
+	Columns []string `yaml:"columns"`
+	// Allowlist restricts the expanded tags, case insensitive (all tags by default).
+	Allowlist []string `yaml:"allowlist"`
+	// Prefix is prepended to the tag labels (tag_ by default).
+	Prefix string `yaml:"prefix"`
+	// DropColumn removes the label with all the tags of the column once expanded.
+	DropColumn bool `yaml:"dropColumn"`
+}
+
+// RelabelConfig is a Prometheus relabel_config.
+type RelabelConfig struct {
+	SourceLabels []string `yaml:"sourceLabels"`
+	// Separator joins the values of the source labels (; by default).
+	Separator string `yaml:"separator"`
+	// Regex is matched against the joined values, or the label names for labelmap, labeldrop and labelkeep ((.*) by default).
+	Regex string `yaml:"regex"`
+	// Modulus is the modulus of the hash of the joined values for hashmod.
+	Modulus     uint64 `yaml:"modulus"`
+	TargetLabel string `yaml:"targetLabel"`
+	// Replacement is expanded with the regex groups ($1 by default).
+	Replacement *string `yaml:"replacement"`
+	// Action is replace (default), keep, drop, hashmod, labelmap, labeldrop or labelkeep.
+	Action string `yaml:"action"`
+}
+
+// ParseExporter reads the exporter settings from the content of the configuration file.
+func ParseExporter(data []byte) (Exporter, error) {
+	parse := struct {
+		Spec struct {
+			ExporterConfig Exporter `yaml:"exporterConfig"`
+		} `yaml:"spec"`
+	}{}
+
+	err := yaml.Unmarshal(data, &parse)
+	if err != nil {
+		return Exporter{}, err
+	}
+
+	return parse.Spec.ExporterConfig, nil
+}
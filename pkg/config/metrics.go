@@ -0,0 +1,60 @@
+package config
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type Metrics struct {
+	Value []Value `json:"value"`
+}
+
+type Value struct {
+	Id         string       `json:"id"`
+	Name       Name         `json:"name"`
+	Unit       string       `json:"unit"`
+	Timeseries []Timeseries `json:"timeseries"`
+}
+
+type Name struct {
+	Value          string `json:"value"`
+	LocalizedValue string `json:"localizedValue"`
+}
+
+type Timeseries struct {
+	MetadataValues []MetadataValue `json:"metadatavalues"`
+	Data           []Data          `json:"data"`
+}
+
+// MetadataValue is the value of a dimension of the timeseries, e.g. ApiName.
+type MetadataValue struct {
+	Name  Name   `json:"name"`
+	Value string `json:"value"`
+}
+
+// Data holds the aggregations of a sample, only the requested aggregations are returned.
+type Data struct {
+	Timestamp metav1.Time        `json:"timeStamp"`
+	Average   *resource.Quantity `json:"average"`
+	Total     *resource.Quantity `json:"total"`
+	Minimum   *resource.Quantity `json:"minimum"`
+	Maximum   *resource.Quantity `json:"maximum"`
+	Count     *resource.Quantity `json:"count"`
+}
+
+// Aggregations returns the aggregations of the sample by name, skipping the missing ones.
+func (d Data) Aggregations() map[string]*resource.Quantity {
+	res := map[string]*resource.Quantity{}
+	for name, value := range map[string]*resource.Quantity{
+		"average": d.Average,
+		"total":   d.Total,
+		"minimum": d.Minimum,
+		"maximum": d.Maximum,
+		"count":   d.Count,
+	} {
+		if value != nil {
+			res[name] = value
+		}
+	}
+	return res
+}
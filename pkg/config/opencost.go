@@ -0,0 +1,33 @@
+package config
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OpenCostAllocations is the response of the OpenCost (/allocation/compute) and
+// Kubecost (/model/allocation) allocation APIs.
+type OpenCostAllocations struct {
+	Code    int                             `json:"code"`
+	Status  string                          `json:"status"`
+	Message string                          `json:"message"`
+	Data    []map[string]OpenCostAllocation `json:"data"`
+}
+
+type OpenCostAllocation struct {
+	Name       string             `json:"name"`
+	Properties OpenCostProperties `json:"properties"`
+	Start      metav1.Time        `json:"start"`
+	End        metav1.Time        `json:"end"`
+	CPUCost    float64            `json:"cpuCost"`
+	RAMCost    float64            `json:"ramCost"`
+	TotalCost  float64            `json:"totalCost"`
+}
+
+type OpenCostProperties struct {
+	Cluster        string `json:"cluster"`
+	Node           string `json:"node"`
+	Namespace      string `json:"namespace"`
+	ControllerKind string `json:"controllerKind"`
+	Controller     string `json:"controller"`
+	Pod            string `json:"pod"`
+}
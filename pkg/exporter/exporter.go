@@ -0,0 +1,508 @@
+// Package exporter scrapes an endpoint described by an ExporterScraperConfig and exports
+// its records as Prometheus series. It is the library behind the exporter binary, and it
+// can be embedded in other programs:
+//
+//	cfg, err := exporter.LoadConfigFile("/config/config.yaml")
+//	...
+//	e, err := exporter.New(cfg, exporter.Options{Registerer: registry})
+//	...
+//	go e.Run(ctx)
+package exporter
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+	"k8s.io/client-go/rest"
+
+	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/internal/helpers/kube/httpcall"
+	configmetrics "github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/config"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes/builtin"
+)
+
+// Config is the configuration of an exporter: the ExporterScraperConfig and the exporter
+// settings read from the same file, under spec.exporterConfig.
+type Config struct {
+	Scraper  finopsdatatypes.ExporterScraperConfig
+	Settings configmetrics.Exporter
+}
+
+// ParseConfig reads the configuration from the content of a configuration file.
+func ParseConfig(data []byte) (Config, error) {
+	scraper := finopsdatatypes.ExporterScraperConfig{}
+	err := yaml.Unmarshal(data, &scraper)
+	if err != nil {
+		return Config{}, err
+	}
+
+	settings, err := configmetrics.ParseExporter(data)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return Config{Scraper: scraper, Settings: settings}, nil
+}
+
+// LoadConfigFile reads the configuration from a configuration file.
+func LoadConfigFile(file string) (Config, error) {
+	fileReader, err := os.OpenFile(file, os.O_RDONLY, 0600)
+	if err != nil {
+		return Config{}, err
+	}
+	defer fileReader.Close()
+	data, err := io.ReadAll(fileReader)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return ParseConfig(data)
+}
+
+// Options customizes an exporter, zero values keep the defaults.
+type Options struct {
+	// Registerer receives the exported series (a new registry by default).
+	Registerer prometheus.Registerer
+	// Logger logs the scrapes and the requests (the global zerolog logger by default).
+	Logger *zerolog.Logger
+	// ConstLabels are added to the finops_exporter_* metrics of the exporter, so that several
+	// exporters can register them on the same registerer.
+	ConstLabels prometheus.Labels
+	// MetricTypes decode the responses by metric type (the built-in metric types by default).
+	MetricTypes *metrictypes.Registry
+	// RESTConfig reads the endpoint Secrets and the fan-out ConfigMaps (the in-cluster configuration by default).
+	RESTConfig *rest.Config
+	// Username and Groups are impersonated to read the endpoint Secrets and the fan-out ConfigMaps.
+	Username string
+	Groups   []string
+	// AuthNamespace, if set, is the only namespace Secrets and ConfigMaps are read from.
+	AuthNamespace string
+	// Reload, if set, is called before every scrape to refresh the configuration, e.g. from a file.
+	Reload func() (Config, error)
+	// Status, if set, reports the outcome of the scrapes to the ExporterScraperConfig.
+	Status *StatusOptions
+	// LeaderElection, if set, runs the exporter as one of several replicas, only the leader scrapes.
+	LeaderElection *LeaderElectionOptions
+	// SnapshotFile, if set, keeps the last snapshot across restarts, e.g. on a persistent volume.
+	SnapshotFile string
+	// Refresh, if set, enables the on-demand refreshes.
+	Refresh *RefreshOptions
+}
+
+// Series is an exported series with its latest value.
+type Series struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+	// Timestamp is the timestamp of the sample, zero unless a timestamp column is configured.
+	Timestamp time.Time
+}
+
+// Snapshot is the outcome of the last successful scrape.
+type Snapshot struct {
+	// Time is the start time of the scrape.
+	Time time.Time
+	// Records are the records of the scrape, the first record being the header.
+	Records [][]string
+	// Series are the exported series.
+	Series []Series
+}
+
+// Exporter periodically scrapes the endpoint of its configuration and exports the records.
+type Exporter struct {
+	opts        Options
+	log         zerolog.Logger
+	registerer  prometheus.Registerer
+	gatherer    prometheus.Gatherer
+	metricTypes *metrictypes.Registry
+
+	mu         sync.RWMutex
+	config     Config
+	configured bool
+	// The configuration was removed, the series are cleared by the scrape loop
+	removed  bool
+	snapshot Snapshot
+	// Signals a configuration change to the running scrape loop
+	changed chan struct{}
+	// Signals a requested refresh to the running scrape loop, and the refresh the next cycle serves
+	refresh        chan struct{}
+	refreshMu      sync.Mutex
+	pendingRefresh *refreshRequest
+
+	// Guards the exported series, updated by the scrapes or by the snapshots of the leader
+	seriesMu sync.Mutex
+	// Exported series by record key
+	prometheusMetrics map[string]recordGaugeCombo
+	// Series of the snapshot of the leader by series identity, while following
+	followerSeries map[string]*timestampedGauge
+	// Start time of the last request whose records were exported, for the lastScrapeTime variable
+	lastScrape time.Time
+	// Configuration of the exported series, kept as they are while the records are unchanged
+	published Config
+	// Last response to each request, for the conditional requests
+	responses *httpcall.ResponseCache
+	// Columns renamed to be valid label names, logged when they change
+	previousLabelMapping map[string]string
+	labelMappingInfo     *prometheus.GaugeVec
+	backfill             *backfillSnapshot
+	// The exported snapshot is restored from the snapshot file and not scraped yet
+	snapshotStale prometheus.Gauge
+	// Start time of the scrape of the exported snapshot
+	snapshotTimestamp prometheus.Gauge
+	// Time spent waiting for the rate limiters of the endpoints
+	rateLimitWait prometheus.Counter
+	// Start time of the next scheduled scrape
+	nextScrapeTimestamp prometheus.Gauge
+	// Consecutive failed scrapes, for the status Events
+	failures int
+	// Whether this replica leads, and the identity of the leader
+	leading atomic.Bool
+	leader  atomic.Value
+}
+
+func New(cfg Config, opts Options) (*Exporter, error) {
+	e := &Exporter{
+		opts:                 opts,
+		log:                  log.Logger,
+		registerer:           opts.Registerer,
+		metricTypes:          opts.MetricTypes,
+		config:               cfg,
+		configured:           !reflect.ValueOf(cfg).IsZero(),
+		changed:              make(chan struct{}, 1),
+		refresh:              make(chan struct{}, 1),
+		prometheusMetrics:    map[string]recordGaugeCombo{},
+		followerSeries:       map[string]*timestampedGauge{},
+		responses:            httpcall.NewResponseCache(),
+		previousLabelMapping: map[string]string{},
+		labelMappingInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "finops_exporter_label_mapping_info",
+			Help:        "Columns renamed to be valid Prometheus label names.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"column", "label"}),
+	}
+	if opts.Logger != nil {
+		e.log = *opts.Logger
+	}
+	if e.registerer == nil {
+		registry := prometheus.NewRegistry()
+		e.registerer = registry
+		e.gatherer = registry
+	} else if gatherer, ok := e.registerer.(prometheus.Gatherer); ok {
+		e.gatherer = gatherer
+	}
+	if e.metricTypes == nil {
+		e.metricTypes = builtin.NewRegistry()
+	}
+	e.backfill = &backfillSnapshot{log: e.log}
+
+	e.snapshotStale = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "finops_exporter_snapshot_stale",
+		Help:        "1 if the exported series are restored from the snapshot file and not scraped since the start.",
+		ConstLabels: opts.ConstLabels,
+	})
+	e.snapshotTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "finops_exporter_snapshot_timestamp_seconds",
+		Help:        "Start time of the scrape of the exported series, in seconds since the epoch.",
+		ConstLabels: opts.ConstLabels,
+	})
+	e.rateLimitWait = prometheus.NewCounter(prometheus.CounterOpts{
+		Name:        "finops_exporter_rate_limit_wait_seconds_total",
+		Help:        "Time spent waiting for the rate limiter of the endpoint before the requests, in seconds.",
+		ConstLabels: opts.ConstLabels,
+	})
+	e.nextScrapeTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "finops_exporter_next_scrape_timestamp_seconds",
+		Help:        "Start time of the next scheduled scrape, in seconds since the epoch.",
+		ConstLabels: opts.ConstLabels,
+	})
+	for _, collector := range []prometheus.Collector{e.snapshotStale, e.snapshotTimestamp, e.rateLimitWait, e.nextScrapeTimestamp} {
+		if err := e.registerer.Register(collector); err != nil {
+			return nil, fmt.Errorf("error while registering the exporter metrics: %w", err)
+		}
+	}
+
+	return e, nil
+}
+
+// Run scrapes the endpoint every polling interval until the context is canceled. With
+// leader election, only the leader scrapes and the other replicas export its snapshot.
+func (e *Exporter) Run(ctx context.Context) error {
+	// The last snapshot is exported until the first scrape completes
+	if err := e.restoreSnapshot(); err != nil {
+		e.log.Warn().Err(err).Msg("error while restoring the snapshot")
+	}
+
+	if e.opts.LeaderElection != nil {
+		return e.runElected(ctx)
+	}
+	return e.poll(ctx)
+}
+
+// poll scrapes the endpoint every polling interval, or on the schedule, until the context is canceled.
+func (e *Exporter) poll(ctx context.Context) error {
+	for {
+		// The refreshes requested until now are served by this cycle
+		refresh := e.takeRefresh()
+		result, next := e.cycle(ctx)
+		refresh.complete(result)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := e.waitUntil(ctx, next); err != nil {
+			return err
+		}
+	}
+}
+
+// cycle scrapes the endpoint once with the current configuration, and returns the outcome and the
+// start time of the next cycle.
+func (e *Exporter) cycle(ctx context.Context) (scrapeResult, time.Time) {
+	cfg, configured, err := e.reload()
+	if err == nil && !configured {
+		e.log.Debug().Msg("waiting for a configuration...")
+		if e.takeConfigRemoved() {
+			e.log.Info().Msg("configuration removed, clearing the exported series")
+			e.clearSeries()
+		}
+		return scrapeResult{time: time.Now(), err: errors.New("no configuration")}, time.Now().Add(5 * time.Second)
+	}
+	if err != nil {
+		e.log.Error().Err(err).Msg("error while parsing configuration, trying again in 5s...")
+		result := scrapeResult{time: time.Now(), err: &configError{err: err}}
+		e.reportStatus(ctx, cfg, result)
+		return result, time.Now().Add(5 * time.Second)
+	}
+	sched, err := scheduleFor(cfg)
+	if err != nil {
+		e.log.Error().Err(err).Msg("error while parsing schedule, trying again in 5s...")
+		result := scrapeResult{time: time.Now(), err: &configError{err: err}}
+		e.reportStatus(ctx, cfg, result)
+		return result, time.Now().Add(5 * time.Second)
+	}
+
+	scrapeStart := time.Now()
+	err = e.update(ctx, cfg)
+	result := scrapeResult{time: scrapeStart, err: err}
+	if ctx.Err() != nil {
+		return result, time.Now()
+	}
+	if err == nil {
+		snapshot := e.Snapshot()
+		result.records = max(len(snapshot.Records)-1, 0)
+		result.series = len(snapshot.Series)
+	}
+	e.reportStatus(ctx, cfg, result)
+	if err != nil {
+		e.log.Error().Err(err).Msg("error while scraping records, trying again in 5s...")
+		return result, time.Now().Add(5 * time.Second)
+	}
+	if err := e.saveSnapshot(); err != nil {
+		e.log.Warn().Err(err).Msg("error while saving the snapshot")
+	}
+
+	// With a schedule, the next scrape starts on time whatever the duration of this one
+	next := nextScrape(cfg, sched, time.Now())
+	e.log.Debug().Msgf("Polling interval set to %s, next scrape at %s, starting sleep...", cfg.Scraper.Spec.ExporterConfig.PollingInterval.Duration.String(), next.Format(time.RFC3339))
+	return result, next
+}
+
+// SetConfig replaces the configuration, a running exporter scrapes again right away if it
+// changed. It returns whether the configuration changed.
+func (e *Exporter) SetConfig(cfg Config) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.configured && reflect.DeepEqual(e.config, cfg) {
+		return false
+	}
+	e.config = cfg
+	e.configured = true
+	e.removed = false
+
+	select {
+	case e.changed <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// ClearConfig removes the configuration, a running exporter stops scraping and stops exporting
+// the series until a configuration is set again.
+func (e *Exporter) ClearConfig() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.configured {
+		return
+	}
+	e.config = Config{}
+	e.configured = false
+	e.removed = true
+
+	select {
+	case e.changed <- struct{}{}:
+	default:
+	}
+}
+
+// takeConfigRemoved returns whether the configuration was removed since the last call.
+func (e *Exporter) takeConfigRemoved() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	removed := e.removed
+	e.removed = false
+	return removed
+}
+
+// clearSeries stops exporting the series and clears the snapshot, without a configuration.
+func (e *Exporter) clearSeries() {
+	e.seriesMu.Lock()
+	defer e.seriesMu.Unlock()
+
+	for key, gaugeObj := range e.prometheusMetrics {
+		e.registerer.Unregister(gaugeObj.gauge)
+		delete(e.prometheusMetrics, key)
+	}
+	e.dropFollowerSeries("")
+	e.backfill.set(nil)
+	e.published = Config{}
+
+	e.mu.Lock()
+	e.snapshot = Snapshot{}
+	e.mu.Unlock()
+}
+
+// Snapshot returns the outcome of the last successful scrape.
+func (e *Exporter) Snapshot() Snapshot {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.snapshot
+}
+
+// Handler serves the exported series, if the registerer is also a gatherer.
+func (e *Exporter) Handler() http.Handler {
+	if e.gatherer == nil {
+		return http.NotFoundHandler()
+	}
+	handler := promhttp.HandlerFor(e.gatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})
+	if e.opts.Refresh == nil || e.opts.Refresh.ScrapeMinAge <= 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The scrape is served right away, the following ones get the refreshed series
+		if time.Since(e.Snapshot().Time) > e.opts.Refresh.ScrapeMinAge && e.scraping() {
+			e.requestRefresh()
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// SnapshotHandler serves the exported series of the snapshot as JSON to the followers, with leader
+// election only. The raw records are never served. The requests are authenticated with the bearer
+// token of the leader election options.
+func (e *Exporter) SnapshotHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		opts := e.opts.LeaderElection
+		if opts == nil || opts.SnapshotToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(opts.SnapshotToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		snapshot := e.Snapshot()
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(Snapshot{Time: snapshot.Time, Series: snapshot.Series}); err != nil {
+			e.log.Warn().Err(err).Msg("error while writing the snapshot")
+		}
+	})
+}
+
+// BackfillHandler serves every record of the last scrape with its own timestamp, in the
+// OpenMetrics format, if the backfill of the timestamp settings is enabled.
+func (e *Exporter) BackfillHandler() http.Handler {
+	return e.backfill
+}
+
+func (e *Exporter) reload() (Config, bool, error) {
+	if e.opts.Reload != nil {
+		cfg, err := e.opts.Reload()
+		if err != nil {
+			return Config{}, false, err
+		}
+		e.SetConfig(cfg)
+		// The change is applied by this iteration already
+		select {
+		case <-e.changed:
+		default:
+		}
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.config, e.configured, nil
+}
+
+// wait sleeps for the duration, unless the configuration changes or the context is canceled first.
+func (e *Exporter) wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-e.changed:
+		return nil
+	case <-e.refresh:
+		return nil
+	case <-timer.C:
+		return nil
+	}
+}
+
+// waitUntil exports the start time of the next scrape and waits for it, or for a configuration change.
+func (e *Exporter) waitUntil(ctx context.Context, next time.Time) error {
+	e.nextScrapeTimestamp.Set(float64(next.Unix()))
+	return e.wait(ctx, time.Until(next))
+}
+
+func (e *Exporter) restConfig() (*rest.Config, error) {
+	if e.opts.RESTConfig != nil {
+		return rest.CopyConfig(e.opts.RESTConfig), nil
+	}
+	rc, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error while loading the in-cluster configuration: %w", err)
+	}
+	return rc, nil
+}
+
+// sleep waits for the duration, or returns the error of the context if it is canceled first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,190 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/internal/helpers/kube/configmaps"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/internal/helpers/kube/httpcall"
+	configmetrics "github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/config"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes"
+)
+
+// scrapeRecords calls the API once, or once per fan-out variable set, and returns the records.
+// unchanged is true when no response changed since the previous scrape.
+func (e *Exporter) scrapeRecords(ctx context.Context, config finopsdatatypes.ExporterScraperConfig, exporter configmetrics.Exporter, endpoint *httpcall.Endpoint, metricType metrictypes.MetricType, lastScrape time.Time) ([][]string, bool, error) {
+	variableSets, err := e.fanOutVariableSets(ctx, exporter.FanOut)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(variableSets) == 0 {
+		resp := e.makeAPIRequest(ctx, config, exporter, endpoint, lastScrape, 0)
+		return e.getRecords(resp, metricType, metrictypes.Source{Config: config, Exporter: exporter})
+	}
+
+	concurrency := exporter.FanOut.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+	maxAttempts := exporter.FanOut.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+
+	// Every variable set labels its records, even the ones that do not define all the variables
+	labelNames := []string{}
+	for _, variableSet := range variableSets {
+		for name := range variableSet {
+			if !slices.Contains(labelNames, name) {
+				labelNames = append(labelNames, name)
+			}
+		}
+	}
+	sort.Strings(labelNames)
+
+	results := make([][][]string, len(variableSets))
+	unchanged := make([]bool, len(variableSets))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, variableSet := range variableSets {
+		wg.Add(1)
+		go func(i int, variableSet map[string]string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			setConfig := *config.DeepCopy()
+			if setConfig.Spec.ExporterConfig.AdditionalVariables == nil {
+				setConfig.Spec.ExporterConfig.AdditionalVariables = map[string]string{}
+			}
+			for name, value := range variableSet {
+				setConfig.Spec.ExporterConfig.AdditionalVariables[name] = value
+			}
+
+			resp := e.makeAPIRequest(ctx, setConfig, exporter, endpoint, lastScrape, maxAttempts)
+			if resp == nil {
+				e.log.Error().Msgf("skipping variable set %v for this iteration", variableSet)
+				return
+			}
+			records, setUnchanged, err := e.getRecords(resp, metricType, metrictypes.Source{Config: setConfig, Exporter: exporter})
+			if err != nil || len(records) == 0 {
+				e.log.Error().Err(err).Msgf("no records for variable set %v", variableSet)
+				return
+			}
+			results[i] = addLabelColumns(records, labelNames, variableSet)
+			unchanged[i] = setUnchanged
+		}(i, variableSet)
+	}
+	wg.Wait()
+
+	return mergeRecords(results), !slices.Contains(unchanged, false), nil
+}
+
+// fanOutVariableSets returns the static variable sets followed by the ones of the selected ConfigMaps.
+func (e *Exporter) fanOutVariableSets(ctx context.Context, fanOut configmetrics.FanOut) ([]map[string]string, error) {
+	variableSets := append([]map[string]string{}, fanOut.VariableSets...)
+	if fanOut.ConfigMapSelector == nil {
+		return variableSets, nil
+	}
+
+	rc, err := e.restConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// An empty namespace would list the ConfigMaps of all the namespaces
+	namespace := fanOut.ConfigMapSelector.Namespace
+	if len(namespace) == 0 {
+		namespace = e.opts.AuthNamespace
+	}
+	if len(namespace) == 0 {
+		return nil, fmt.Errorf("fan-out ConfigMaps namespace is required without an auth namespace")
+	}
+	if len(e.opts.AuthNamespace) > 0 && namespace != e.opts.AuthNamespace {
+		return nil, fmt.Errorf("fan-out ConfigMaps namespace %s is outside of the auth namespace %s", namespace, e.opts.AuthNamespace)
+	}
+	if len(e.opts.Username) > 0 {
+		rc = rest.CopyConfig(rc)
+		rc.Impersonate = rest.ImpersonationConfig{UserName: e.opts.Username, Groups: e.opts.Groups}
+	}
+
+	cli, err := configmaps.NewClient(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := cli.Namespace(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fanOut.ConfigMapSelector.LabelSelector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error while listing fan-out ConfigMaps: %w", err)
+	}
+
+	for _, configMap := range list.Items {
+		variableSets = append(variableSets, configMap.Data)
+	}
+	return variableSets, nil
+}
+
+// addLabelColumns appends a column for each label name, with the value of the variable set,
+// unless the records already have a column with that name.
+func addLabelColumns(records [][]string, labelNames []string, variableSet map[string]string) [][]string {
+	for _, name := range labelNames {
+		if slices.Contains(records[0], name) {
+			continue
+		}
+		records[0] = append(records[0], name)
+		for i := 1; i < len(records); i++ {
+			records[i] = append(records[i], variableSet[name])
+		}
+	}
+	return records
+}
+
+// mergeRecords merges the records of several requests, aligning their columns by header name.
+func mergeRecords(results [][][]string) [][]string {
+	header := []string{}
+	for _, records := range results {
+		if len(records) == 0 {
+			continue
+		}
+		for _, name := range records[0] {
+			if !slices.Contains(header, name) {
+				header = append(header, name)
+			}
+		}
+	}
+	if len(header) == 0 {
+		return nil
+	}
+
+	merged := [][]string{header}
+	for _, records := range results {
+		if len(records) == 0 {
+			continue
+		}
+		indexes := make([]int, len(header))
+		for j, name := range header {
+			indexes[j] = slices.Index(records[0], name)
+		}
+		for _, record := range records[1:] {
+			row := make([]string, len(header))
+			for j, index := range indexes {
+				if index >= 0 && index < len(record) {
+					row[j] = record[index]
+				}
+			}
+			merged = append(merged, row)
+		}
+	}
+	return merged
+}
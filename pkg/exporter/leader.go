@@ -0,0 +1,252 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// LeaderElectionOptions elects the replica that scrapes through a Lease. The other replicas
+// read the snapshot of the leader from its address and export it.
+type LeaderElectionOptions struct {
+	// Client creates and renews the Lease.
+	Client kubernetes.Interface
+	// Namespace and Name of the Lease, shared by the replicas.
+	Namespace string
+	Name      string
+	// Identity of the replica, unique among the replicas (the hostname by default).
+	Identity string
+	// Address the followers read the snapshot of this replica from when it leads, e.g. 10.0.0.1:2112 (required).
+	Address string
+	// SnapshotPath is the path the snapshot handler is served on (/-/snapshot by default).
+	SnapshotPath string
+	// SnapshotToken authenticates the followers to the snapshot handler of the leader, shared by the replicas.
+	SnapshotToken string
+	// SnapshotInterval is how often the followers read the snapshot of the leader (15s by default).
+	SnapshotInterval time.Duration
+	// LeaseDuration, RenewDeadline and RetryPeriod tune the election (15s, 10s and 2s by default).
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// runElected campaigns for the Lease until the context is canceled: the leader scrapes,
+// the followers export the snapshot of the leader.
+func (e *Exporter) runElected(ctx context.Context) error {
+	opts := e.opts.LeaderElection
+	if opts.Client == nil || opts.Namespace == "" || opts.Name == "" {
+		return fmt.Errorf("leader election requires a client and the namespace and name of the Lease")
+	}
+	// Without the address of the leader, the followers would never read its snapshot and export nothing
+	if opts.Address == "" {
+		return fmt.Errorf("leader election requires the address the followers read the snapshot of the leader from")
+	}
+	if opts.SnapshotToken == "" {
+		return fmt.Errorf("leader election requires a snapshot token to serve the snapshot to the followers")
+	}
+
+	identity := opts.Identity
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("error while reading the hostname for the leader election identity: %w", err)
+		}
+		identity = hostname
+	}
+	// The address of the leader is read by the followers from the holder of the Lease
+	identity += "@" + opts.Address
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: opts.Namespace, Name: opts.Name},
+		Client:     opts.Client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+
+	// Signals a new leader, whose snapshot is read right away
+	newLeader := make(chan struct{}, 1)
+	go e.follow(ctx, newLeader)
+	for {
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			Name:            opts.Name,
+			LeaseDuration:   durationOrDefault(opts.LeaseDuration, 15*time.Second),
+			RenewDeadline:   durationOrDefault(opts.RenewDeadline, 10*time.Second),
+			RetryPeriod:     durationOrDefault(opts.RetryPeriod, 2*time.Second),
+			ReleaseOnCancel: true,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					e.log.Info().Msgf("leading as %s, scraping", identity)
+					e.leading.Store(true)
+					e.poll(ctx)
+					// The refresh requested after the last cycle of the loop is not served by this replica
+					e.leading.Store(false)
+					e.cancelRefresh(errNotLeader)
+				},
+				OnStoppedLeading: func() {
+					e.leading.Store(false)
+					e.log.Info().Msgf("stopped leading as %s", identity)
+				},
+				OnNewLeader: func(leader string) {
+					e.log.Info().Msgf("new leader %s", leader)
+					e.leader.Store(leader)
+					select {
+					case newLeader <- struct{}{}:
+					default:
+					}
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		// Run returns when the leadership is lost, the replica campaigns again
+		elector.Run(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// follow exports the snapshot of the leader while this replica is not leading.
+func (e *Exporter) follow(ctx context.Context, newLeader <-chan struct{}) {
+	opts := e.opts.LeaderElection
+	path := opts.SnapshotPath
+	if path == "" {
+		path = "/-/snapshot"
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	ticker := time.NewTicker(durationOrDefault(opts.SnapshotInterval, 15*time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-newLeader:
+		}
+
+		leader, _ := e.leader.Load().(string)
+		_, address, ok := strings.Cut(leader, "@")
+		if e.leading.Load() || !ok {
+			continue
+		}
+
+		snapshot, err := fetchSnapshot(ctx, client, "http://"+address+path, opts.SnapshotToken)
+		if err != nil {
+			e.log.Warn().Err(err).Msgf("error while reading the snapshot of the leader %s", leader)
+			continue
+		}
+		e.applySnapshot(snapshot)
+	}
+}
+
+func fetchSnapshot(ctx context.Context, client *http.Client, url, token string) (Snapshot, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := client.Do(req)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return Snapshot{}, fmt.Errorf("received status code %d", res.StatusCode)
+	}
+
+	snapshot := Snapshot{}
+	err = json.NewDecoder(res.Body).Decode(&snapshot)
+	return snapshot, err
+}
+
+// applySnapshot exports the series of a snapshot of the leader in place of the current ones.
+func (e *Exporter) applySnapshot(snapshot Snapshot) {
+	e.seriesMu.Lock()
+	defer e.seriesMu.Unlock()
+
+	// The series scraped while leading are taken over by the snapshot
+	for key, gaugeObj := range e.prometheusMetrics {
+		e.followerSeries[seriesID(gaugeObj.name, gaugeObj.labels)] = gaugeObj.gauge
+		delete(e.prometheusMetrics, key)
+	}
+
+	seen := map[string]bool{}
+	for _, series := range snapshot.Series {
+		id := seriesID(series.Name, series.Labels)
+		seen[id] = true
+		gauge, ok := e.followerSeries[id]
+		if !ok {
+			gauge = &timestampedGauge{Gauge: prometheus.NewGauge(prometheus.GaugeOpts{
+				Name:        series.Name,
+				ConstLabels: series.Labels,
+			})}
+			if err := e.registerer.Register(gauge); err != nil {
+				e.log.Warn().Err(err).Msgf("skipping this series of the snapshot, error while registering metric %s", series.Name)
+				continue
+			}
+			e.followerSeries[id] = gauge
+		}
+		gauge.Set(series.Value)
+		gauge.SetTimestamp(series.Timestamp)
+	}
+
+	for id, gauge := range e.followerSeries {
+		if !seen[id] {
+			e.registerer.Unregister(gauge)
+			delete(e.followerSeries, id)
+		}
+	}
+
+	e.mu.Lock()
+	e.snapshot = snapshot
+	e.mu.Unlock()
+	e.snapshotStale.Set(0)
+	e.snapshotTimestamp.Set(float64(snapshot.Time.Unix()))
+}
+
+// dropFollowerSeries unregisters a series exported from the snapshot of the leader, or all of them if id is empty.
+func (e *Exporter) dropFollowerSeries(id string) {
+	if id != "" {
+		if gauge, ok := e.followerSeries[id]; ok {
+			e.registerer.Unregister(gauge)
+			delete(e.followerSeries, id)
+		}
+		return
+	}
+
+	for followerID, gauge := range e.followerSeries {
+		e.registerer.Unregister(gauge)
+		delete(e.followerSeries, followerID)
+	}
+}
+
+// seriesID identifies a series by its name and labels.
+func seriesID(name string, labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for label, value := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", label, value))
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+func durationOrDefault(d, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	return d
+}
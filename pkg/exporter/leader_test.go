@@ -0,0 +1,33 @@
+package exporter
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRunElectedRequiresSnapshotAccess(t *testing.T) {
+	tests := []struct {
+		name string
+		opts LeaderElectionOptions
+	}{
+		{name: "no lease", opts: LeaderElectionOptions{Client: fake.NewSimpleClientset(), Address: "10.0.0.1:2112", SnapshotToken: "secret"}},
+		{name: "no address", opts: LeaderElectionOptions{Client: fake.NewSimpleClientset(), Namespace: "finops", Name: "exporter", SnapshotToken: "secret"}},
+		{name: "no snapshot token", opts: LeaderElectionOptions{Client: fake.NewSimpleClientset(), Namespace: "finops", Name: "exporter", Address: "10.0.0.1:2112"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(Config{}, Options{LeaderElection: &tt.opts})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if err := e.runElected(ctx); err == nil || err == context.Canceled {
+				t.Errorf("runElected() = %v, want a configuration error", err)
+			}
+		})
+	}
+}
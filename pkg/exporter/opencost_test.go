@@ -0,0 +1,140 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes/opencost"
+)
+
+const allocations = `{"code":200,"data":[{` +
+	`"team-a/api":{"name":"team-a/api","properties":{"cluster":"c1","namespace":"team-a","pod":"api-0"},"start":"2025-01-01T00:00:00Z","end":"2025-01-02T00:00:00Z","cpuCost":1,"ramCost":0.5,"totalCost":1.5},` +
+	`"team-b/web":{"name":"team-b/web","properties":{"cluster":"c1","namespace":"team-b","pod":"web-0"},"start":"2025-01-01T00:00:00Z","end":"2025-01-02T00:00:00Z","cpuCost":2,"ramCost":1,"totalCost":3}}]}`
+
+// newEndpointServer mocks the Kubernetes API serving the finops/opencost endpoint Secret, whose server
+// URL is the mock server itself, and the API of the endpoint served by the handlers of the mux.
+func newEndpointServer(t *testing.T, mux *http.ServeMux) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("GET /api/v1/namespaces/finops/secrets/opencost", func(w http.ResponseWriter, _ *http.Request) {
+		secret := corev1.Secret{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: metav1.ObjectMeta{Name: "opencost", Namespace: "finops"},
+			Data:       map[string][]byte{"server-url": []byte(srv.URL)},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(secret)
+	})
+	return srv
+}
+
+// newOpenCostServer mocks the OpenCost allocation API.
+func newOpenCostServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /allocation/compute", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("window") != "1d" {
+			http.Error(w, "missing window", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(allocations))
+	})
+	return newEndpointServer(t, mux)
+}
+
+// gatherSeries returns the value of the gathered series by name and labels, formatted as name{labels}.
+func gatherSeries(t *testing.T, registry *prometheus.Registry) map[string]float64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := []string{}
+			for _, label := range metric.GetLabel() {
+				labels = append(labels, label.GetName()+"="+strconv.Quote(label.GetValue()))
+			}
+			series[family.GetName()+"{"+strings.Join(labels, ",")+"}"] = metric.GetGauge().GetValue()
+		}
+	}
+	return series
+}
+
+func TestOpenCostAllocations(t *testing.T) {
+	srv := newOpenCostServer(t)
+
+	cfg := Config{}
+	cfg.Scraper.Spec.ExporterConfig.MetricType = opencost.Name
+	cfg.Scraper.Spec.ExporterConfig.PollingInterval = metav1.Duration{Duration: time.Hour}
+	cfg.Scraper.Spec.ExporterConfig.API = finopsdatatypes.API{
+		Path:        "/allocation/compute?window=1d&aggregate=pod",
+		Verb:        http.MethodGet,
+		EndpointRef: &finopsdatatypes.ObjectRef{Name: "opencost", Namespace: "finops"},
+	}
+
+	registry := prometheus.NewRegistry()
+	logger := zerolog.Nop()
+	e, err := New(cfg, Options{Registerer: registry, Logger: &logger, RESTConfig: &rest.Config{Host: srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.update(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["x_Namespace"] == "" {
+				continue
+			}
+			got[family.GetName()+" "+labels["x_Namespace"]+" "+labels["x_CostComponent"]] = metric.GetGauge().GetValue()
+		}
+	}
+
+	want := map[string]float64{
+		"billed_cost team-a total":         1.5,
+		"billed_cost_component team-a cpu": 1,
+		"billed_cost_component team-a ram": 0.5,
+		"billed_cost team-b total":         3,
+		"billed_cost_component team-b cpu": 2,
+		"billed_cost_component team-b ram": 1,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d series, want %d: %v", len(got), len(want), got)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package exporter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// saveSnapshot writes the snapshot to the snapshot file, replacing the previous one atomically.
+func (e *Exporter) saveSnapshot() error {
+	file := e.opts.SnapshotFile
+	if file == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(e.Snapshot())
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// restoreSnapshot exports the series of the snapshot file, marked as stale until a scrape succeeds.
+func (e *Exporter) restoreSnapshot() error {
+	file := e.opts.SnapshotFile
+	if file == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	snapshot := Snapshot{}
+	err = json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return fmt.Errorf("error while decoding snapshot file %s: %w", file, err)
+	}
+
+	e.applySnapshot(snapshot)
+	e.snapshotStale.Set(1)
+	e.log.Info().Msgf("restored %d series scraped at %s from %s", len(snapshot.Series), snapshot.Time, file)
+	return nil
+}
@@ -0,0 +1,135 @@
+package exporter
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RefreshOptions enables the refreshes on demand, in between the scheduled scrapes.
+type RefreshOptions struct {
+	// Token authenticates the requests to the refresh handler as a bearer token, the handler is disabled without it.
+	Token string
+	// ScrapeMinAge, if positive, makes a scrape of the metrics handler trigger a refresh when the snapshot is older.
+	ScrapeMinAge time.Duration
+}
+
+// refreshRequest is completed by the cycle serving the refreshes requested before it started.
+type refreshRequest struct {
+	done   chan struct{}
+	result scrapeResult
+}
+
+func (r *refreshRequest) complete(result scrapeResult) {
+	if r == nil {
+		return
+	}
+	r.result = result
+	close(r.done)
+}
+
+// refreshResponse is the outcome of a refresh served by the refresh handler.
+type refreshResponse struct {
+	Time    time.Time `json:"time"`
+	Records int       `json:"records"`
+	Series  int       `json:"series"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// errNotLeader completes the refreshes pending when the leadership is lost.
+var errNotLeader = errors.New("not the leader")
+
+// requestRefresh wakes the scrape loop up, the refreshes requested before the next cycle starts share it.
+// It returns nil when this replica does not scrape.
+func (e *Exporter) requestRefresh() *refreshRequest {
+	e.refreshMu.Lock()
+	defer e.refreshMu.Unlock()
+
+	// Checked under the lock, so that a refresh is either rejected or completed by cancelRefresh
+	if !e.scraping() {
+		return nil
+	}
+	if e.pendingRefresh == nil {
+		e.pendingRefresh = &refreshRequest{done: make(chan struct{})}
+	}
+	select {
+	case e.refresh <- struct{}{}:
+	default:
+	}
+	return e.pendingRefresh
+}
+
+// takeRefresh returns the refresh the starting cycle serves, if any.
+func (e *Exporter) takeRefresh() *refreshRequest {
+	e.refreshMu.Lock()
+	defer e.refreshMu.Unlock()
+
+	refresh := e.pendingRefresh
+	e.pendingRefresh = nil
+	select {
+	case <-e.refresh:
+	default:
+	}
+	return refresh
+}
+
+// cancelRefresh completes the pending refresh with the error, once the scrape loop stopped.
+func (e *Exporter) cancelRefresh(err error) {
+	e.takeRefresh().complete(scrapeResult{time: time.Now(), err: err})
+}
+
+// scraping returns whether this replica runs the scrape loop, the followers only export the snapshot of the leader.
+func (e *Exporter) scraping() bool {
+	return e.opts.LeaderElection == nil || e.leading.Load()
+}
+
+// RefreshHandler serves POST requests that scrape the endpoint right away and answer with the outcome.
+// Concurrent requests share the same scrape. The requests are authenticated with the bearer token of
+// the refresh options.
+func (e *Exporter) RefreshHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if e.opts.Refresh == nil || e.opts.Refresh.Token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(e.opts.Refresh.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		refresh := e.requestRefresh()
+		if refresh != nil {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-refresh.done:
+			}
+		}
+		if refresh == nil || errors.Is(refresh.result.err, errNotLeader) {
+			leader, _ := e.leader.Load().(string)
+			http.Error(w, "not the leader, the leader is "+leader, http.StatusServiceUnavailable)
+			return
+		}
+
+		res := refreshResponse{Time: refresh.result.time, Records: refresh.result.records, Series: refresh.result.series}
+		status := http.StatusOK
+		if refresh.result.err != nil {
+			res.Error = refresh.result.err.Error()
+			status = http.StatusBadGateway
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			e.log.Warn().Err(err).Msg("error while writing the refresh response")
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package exporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRefreshLeadershipLost(t *testing.T) {
+	e, err := New(Config{}, Options{
+		LeaderElection: &LeaderElectionOptions{},
+		Refresh:        &RefreshOptions{Token: "secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.leading.Store(true)
+
+	refresh := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/-/refresh", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		e.RefreshHandler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The refresh is requested while leading, but the scrape loop stops before serving it
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- refresh() }()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		e.refreshMu.Lock()
+		pending := e.pendingRefresh != nil
+		e.refreshMu.Unlock()
+		if pending {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the refresh request")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	e.leading.Store(false)
+	e.cancelRefresh(errNotLeader)
+
+	select {
+	case rec := <-done:
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("got status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the refresh is still pending after the leadership is lost")
+	}
+
+	// Once the leadership is lost, the refreshes are rejected right away
+	if rec := refresh(); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,333 @@
+package exporter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/internal/helpers/kube/endpoints"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/internal/helpers/kube/httpcall"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/internal/utils"
+	configmetrics "github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/config"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes"
+)
+
+// resolveEndpoint reads the endpoint referenced by the exporter config, impersonating
+// and restricting the auth namespace as configured in the options.
+func (e *Exporter) resolveEndpoint(ctx context.Context, config finopsdatatypes.ExporterScraperConfig, exporter configmetrics.Exporter) (*httpcall.Endpoint, error) {
+	rc, err := e.restConfig()
+	if err != nil {
+		return &httpcall.Endpoint{}, err
+	}
+
+	endpoint, err := endpoints.Resolve(ctx, endpoints.ResolveOptions{
+		RESTConfig: rc,
+		API:        &config.Spec.ExporterConfig.API,
+		AuthNS:     e.opts.AuthNamespace,
+		Username:   e.opts.Username,
+		Groups:     e.opts.Groups,
+	})
+	if err != nil {
+		return &httpcall.Endpoint{}, err
+	}
+
+	// Replace variables in server URL
+	endpoint.ServerURL, err = utils.ReplaceVariables(endpoint.ServerURL, config.Spec.ExporterConfig.AdditionalVariables, utils.ReplaceOptions{LegacyEnvLookup: exporter.LegacyEnvLookup})
+	if err != nil {
+		return &httpcall.Endpoint{}, fmt.Errorf("error while replacing variables in server URL: %w", err)
+	}
+
+	endpoint.Transport = httpcall.TransportOptions{
+		Timeout:               exporter.HTTP.Timeout,
+		DialTimeout:           exporter.HTTP.DialTimeout,
+		TLSHandshakeTimeout:   exporter.HTTP.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: exporter.HTTP.ResponseHeaderTimeout,
+		IdleConnTimeout:       exporter.HTTP.IdleConnTimeout,
+		MaxIdleConns:          exporter.HTTP.MaxIdleConns,
+		MaxIdleConnsPerHost:   exporter.HTTP.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       exporter.HTTP.MaxConnsPerHost,
+		DisableHTTP2:          exporter.HTTP.DisableHTTP2,
+	}
+
+	endpoint.RateLimit = httpcall.RateLimitOptions{
+		QPS:          exporter.HTTP.RateLimit.QPS,
+		Burst:        exporter.HTTP.RateLimit.Burst,
+		MinRemaining: exporter.HTTP.RateLimit.MinRemaining,
+	}
+
+	endpoint.Debug = endpoint.Debug || exporter.Debug.Enabled
+	endpoint.DebugOptions = httpcall.DebugOptions{
+		RedactHeaders: exporter.Debug.RedactHeaders,
+		RedactFields:  exporter.Debug.RedactFields,
+		MaxBodySize:   exporter.Debug.MaxBodySize,
+	}
+
+	return endpoint, nil
+}
+
+// requestAPI returns the API of the exporter config with the additional and time window
+// variables replaced in path, headers and payload.
+func requestAPI(config finopsdatatypes.ExporterScraperConfig, exporter configmetrics.Exporter, lastScrape time.Time) (finopsdatatypes.API, map[string]string, error) {
+	api := config.Spec.ExporterConfig.API
+
+	timeOpts := timeWindowOptions(exporter)
+	now := time.Now()
+	timeVariables, err := utils.TimeWindowVariables(now, lastScrape, timeOpts)
+	if err != nil {
+		return api, nil, err
+	}
+
+	// The path, headers and payload are rendered as templates afterwards, the values are escaped so that they are never executed
+	opts := utils.ReplaceOptions{
+		Lookup:          utils.TimeVariablesLookup(now, timeVariables, timeOpts),
+		LegacyEnvLookup: exporter.LegacyEnvLookup,
+		EscapeTemplates: true,
+	}
+	api.Payload, err = utils.ReplaceVariables(api.Payload, config.Spec.ExporterConfig.AdditionalVariables, opts)
+	if err != nil {
+		return api, nil, fmt.Errorf("error while replacing variables in payload: %w", err)
+	}
+
+	api.Headers = make([]string, len(config.Spec.ExporterConfig.API.Headers))
+	for i, header := range config.Spec.ExporterConfig.API.Headers {
+		api.Headers[i], err = utils.ReplaceVariables(header, config.Spec.ExporterConfig.AdditionalVariables, opts)
+		if err != nil {
+			return api, nil, fmt.Errorf("error while replacing variables in headers: %w", err)
+		}
+	}
+
+	// Values replaced in the API path are URL-encoded
+	opts.URLEncode = true
+	api.Path, err = utils.ReplaceVariables(api.Path, config.Spec.ExporterConfig.AdditionalVariables, opts)
+	if err != nil {
+		return api, nil, fmt.Errorf("error while replacing variables in path: %w", err)
+	}
+
+	return api, timeVariables, nil
+}
+
+func timeWindowOptions(exporter configmetrics.Exporter) utils.TimeWindowOptions {
+	return utils.TimeWindowOptions{
+		Timezone:              exporter.TimeWindow.Timezone,
+		Format:                exporter.TimeWindow.Format,
+		Formats:               exporter.TimeWindow.Formats,
+		BillingPeriodStartDay: exporter.TimeWindow.BillingPeriodStartDay,
+		InitialLookback:       exporter.TimeWindow.InitialLookback,
+	}
+}
+
+// templateData is the data available to the path, headers and payload templates. The credentials are
+// applied by the client and never rendered, e.g. in the logged path.
+func templateData(config finopsdatatypes.ExporterScraperConfig, endpoint *httpcall.Endpoint, timeVariables map[string]string) map[string]any {
+	variables := map[string]any{}
+	for key, value := range config.Spec.ExporterConfig.AdditionalVariables {
+		variables[key] = value
+	}
+
+	timeWindow := map[string]any{}
+	for key, value := range timeVariables {
+		timeWindow[key] = value
+	}
+
+	return map[string]any{
+		"vars": variables,
+		"endpoint": map[string]any{
+			"serverURL":  endpoint.ServerURL,
+			"proxyURL":   endpoint.ProxyURL,
+			"serverName": endpoint.ServerName,
+			"username":   endpoint.Username,
+		},
+		"metricType": config.Spec.ExporterConfig.MetricType,
+		"time":       timeWindow,
+	}
+}
+
+// apiResponse is a successful response of the API.
+type apiResponse struct {
+	res         *http.Response
+	data        []byte
+	contentType string
+	// The API answered 304 Not Modified to a conditional request
+	notModified bool
+}
+
+// makeAPIRequest calls the API until it succeeds, or up to maxAttempts times if maxAttempts is positive.
+func (e *Exporter) makeAPIRequest(ctx context.Context, config finopsdatatypes.ExporterScraperConfig, exporter configmetrics.Exporter, endpoint *httpcall.Endpoint, lastScrape time.Time, maxAttempts int) *apiResponse {
+	var cache *httpcall.ResponseCache
+	if exporter.HTTP.ConditionalRequests || exporter.HTTP.SkipUnchanged {
+		cache = e.responses
+	}
+	variant := decodeVariant(metrictypes.Source{Config: config, Exporter: exporter})
+	unconditional := false
+
+	var res *http.Response
+	for attempt := 1; ; attempt++ {
+		retryDelay := 5 * time.Second
+		// The client is cached per endpoint configuration, so connections are reused across polls
+		httpClient, err := httpcall.CachedHTTPClientForEndpoint(endpoint)
+		api, timeVariables, errAPI := requestAPI(config, exporter, lastScrape)
+		if err != nil {
+			e.log.Warn().Err(err).Msg("error while creating HTTP client")
+		} else if errAPI != nil {
+			e.log.Warn().Err(errAPI).Msg("error while preparing the API request")
+		} else {
+			res, err = httpcall.Do(ctx, httpClient, httpcall.Options{
+				API:           &api,
+				Endpoint:      endpoint,
+				DS:            templateData(config, endpoint, timeVariables),
+				Cache:         cache,
+				CacheVariant:  variant,
+				Unconditional: unconditional,
+				OnRateLimitWait: func(d time.Duration) {
+					e.rateLimitWait.Add(d.Seconds())
+				},
+				Logger: &e.log,
+			})
+			if err == nil && res.StatusCode == http.StatusOK {
+				break
+			}
+			if err == nil && res.StatusCode == http.StatusNotModified && cache != nil && !unconditional {
+				res.Body.Close()
+				if cached, ok := cache.Lookup(res); ok && cached.Variant == variant {
+					e.log.Info().Msg("Response not modified since the last request")
+					return &apiResponse{res: res, notModified: true}
+				}
+				// The validators of the API headers matched, or the cached records are decoded with another configuration
+				e.log.Info().Msg("Response not modified, but no records are cached for the current configuration, requesting it again without validators")
+				unconditional = true
+				attempt--
+				continue
+			}
+
+			if err == nil {
+				// A throttled endpoint is not called again before the delay it asks for
+				if retryAfter, ok := httpcall.RetryAfter(res); ok && retryAfter > retryDelay {
+					retryDelay = retryAfter
+				}
+				e.log.Warn().Msgf("Received status code %d", res.StatusCode)
+				// Error bodies can echo credentials, e.g. those of token endpoints
+				body := httpcall.RedactedBody(res.Body, endpoint.DebugOptions)
+				res.Body.Close()
+				e.log.Warn().Msgf("Body %s", body)
+			} else {
+				e.log.Warn().Err(err).Msg("error occurred while making API call")
+			}
+		}
+		if maxAttempts > 0 && attempt >= maxAttempts {
+			e.log.Error().Msgf("API call failed %d times, giving up", attempt)
+			return nil
+		}
+		e.log.Warn().Msgf("Retrying connection in %s...", retryDelay)
+		if err := sleep(ctx, retryDelay); err != nil {
+			return nil
+		}
+
+		e.log.Info().Msgf("Parsing Endpoint again...")
+		resolved, err := e.resolveEndpoint(ctx, config, exporter)
+		if err != nil {
+			e.log.Warn().Err(err).Msg("error while resolving endpoint")
+			continue
+		}
+		endpoint = resolved
+	}
+
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		e.log.Warn().Err(err).Msg("an error has occured while reading response body")
+	}
+
+	// "Content-Encoding: gzip" is automatically handlded by go's HTTP transport
+	e.log.Debug().Msgf("Content-Type: %s", strings.ToLower(res.Header.Get("Content-Type")))
+	e.log.Debug().Msgf("Content-Length: %s", strings.ToLower(res.Header.Get("Content-Length")))
+
+	// The metric types decode the data according to its content type
+	contentType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if contentType == "application/json" || contentType == "text/csv" {
+		return &apiResponse{res: res, data: utils.TrapBOM(data), contentType: contentType}
+	}
+	e.log.Error().Msgf("Content-Type not supported: %s", strings.ToLower(res.Header.Get("Content-Type")))
+	return nil
+}
+
+// getRecords decodes the response data with the metric type of the config. The records of the
+// previous response are returned, and unchanged is true, when the response is not modified or,
+// with skipUnchanged, when the content hash of the body is the same.
+func (e *Exporter) getRecords(resp *apiResponse, metricType metrictypes.MetricType, src metrictypes.Source) (records [][]string, unchanged bool, err error) {
+	if resp == nil {
+		return nil, false, fmt.Errorf("no data received from the API")
+	}
+	// The records cached with another configuration are decoded again
+	variant := decodeVariant(src)
+	cached, ok := e.responses.Lookup(resp.res)
+	ok = ok && cached.Variant == variant
+	if resp.notModified {
+		if !ok {
+			return nil, false, fmt.Errorf("response not modified, but no previous response is cached")
+		}
+		return cloneRecords(cached.Value.([][]string)), true, nil
+	}
+
+	settings := src.Exporter.HTTP
+	hash := ""
+	if settings.SkipUnchanged {
+		sum := sha256.Sum256(resp.data)
+		hash = hex.EncodeToString(sum[:])
+		if ok && cached.Hash == hash {
+			e.log.Info().Msg("Response body unchanged since the last request")
+			records, unchanged = cloneRecords(cached.Value.([][]string)), true
+		}
+	}
+	if !unchanged {
+		records, err = metricType.Decode(resp.data, resp.contentType, src)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if settings.ConditionalRequests || settings.SkipUnchanged {
+		entry := httpcall.CachedResponse{Hash: hash, Value: cloneRecords(records), Variant: variant}
+		if settings.ConditionalRequests {
+			entry.ETag = resp.res.Header.Get("ETag")
+			entry.LastModified = resp.res.Header.Get("Last-Modified")
+		}
+		e.responses.Store(resp.res, entry)
+	}
+	return records, unchanged, nil
+}
+
+// decodeVariant hashes what the records depend on besides the response body: the metric type, the
+// JSON mapping and the additional variables (e.g. BillingCurrency).
+func decodeVariant(src metrictypes.Source) string {
+	data, _ := json.Marshal(struct {
+		MetricType          string
+		Mapping             configmetrics.Mapping
+		AdditionalVariables map[string]string
+	}{
+		MetricType:          strings.ToLower(src.Config.Spec.ExporterConfig.MetricType),
+		Mapping:             src.Exporter.Mapping,
+		AdditionalVariables: src.Config.Spec.ExporterConfig.AdditionalVariables,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cloneRecords copies the records, which are modified when the fan-out labels are added.
+func cloneRecords(records [][]string) [][]string {
+	cloned := make([][]string, len(records))
+	for i, record := range records {
+		cloned[i] = slices.Clone(record)
+	}
+	return cloned
+}
@@ -0,0 +1,138 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+
+	configmetrics "github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/config"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes/opencost"
+)
+
+// conditionalServer serves the allocations with an ETag, and answers 304 to the requests with the same ETag.
+type conditionalServer struct {
+	mu         sync.Mutex
+	validators []string
+}
+
+func (s *conditionalServer) handler(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.validators = append(s.validators, r.Header.Get("If-None-Match"))
+	s.mu.Unlock()
+
+	w.Header().Set("ETag", `"v1"`)
+	if r.Header.Get("If-None-Match") == `"v1"` {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(allocations))
+}
+
+func (s *conditionalServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.validators...)
+}
+
+func conditionalConfig(currency string, headers ...string) Config {
+	cfg := Config{Settings: configmetrics.Exporter{HTTP: configmetrics.HTTP{ConditionalRequests: true}}}
+	cfg.Scraper.Spec.ExporterConfig.MetricType = opencost.Name
+	cfg.Scraper.Spec.ExporterConfig.PollingInterval = metav1.Duration{Duration: time.Hour}
+	cfg.Scraper.Spec.ExporterConfig.AdditionalVariables = map[string]string{"BillingCurrency": currency}
+	cfg.Scraper.Spec.ExporterConfig.API = finopsdatatypes.API{
+		Path:        "/allocation/compute?window=1d",
+		Verb:        http.MethodGet,
+		Headers:     headers,
+		EndpointRef: &finopsdatatypes.ObjectRef{Name: "opencost", Namespace: "finops"},
+	}
+	return cfg
+}
+
+// currencies returns the BillingCurrency labels of the exported billed_cost series.
+func currencies(t *testing.T, registry *prometheus.Registry) map[string]bool {
+	t.Helper()
+	res := map[string]bool{}
+	for series := range gatherSeries(t, registry) {
+		if !strings.HasPrefix(series, "billed_cost{") {
+			continue
+		}
+		_, currency, _ := strings.Cut(series, `BillingCurrency="`)
+		currency, _, _ = strings.Cut(currency, `"`)
+		res[currency] = true
+	}
+	return res
+}
+
+func TestConditionalRequestsDecodeAgainOnConfigChange(t *testing.T) {
+	server := &conditionalServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /allocation/compute", server.handler)
+	srv := newEndpointServer(t, mux)
+
+	registry := prometheus.NewRegistry()
+	logger := zerolog.Nop()
+	cfg := conditionalConfig("USD")
+	e, err := New(cfg, Options{Registerer: registry, Logger: &logger, RESTConfig: &rest.Config{Host: srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		currency      string
+		wantValidator string
+	}{
+		{currency: "USD", wantValidator: ""},
+		// Same configuration, the cached records are reused
+		{currency: "USD", wantValidator: `"v1"`},
+		// The cached records are decoded with USD, the request is not conditional
+		{currency: "EUR", wantValidator: ""},
+		{currency: "EUR", wantValidator: `"v1"`},
+	}
+	for i, step := range steps {
+		cfg := conditionalConfig(step.currency)
+		if err := e.update(context.Background(), cfg); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if got := currencies(t, registry); len(got) != 1 || !got[step.currency] {
+			t.Errorf("step %d: exported currencies %v, want %s", i, got, step.currency)
+		}
+		if requests := server.requests(); requests[len(requests)-1] != step.wantValidator {
+			t.Errorf("step %d: sent If-None-Match %q, want %q", i, requests[len(requests)-1], step.wantValidator)
+		}
+	}
+}
+
+func TestConditionalRequestsWithoutCachedRecords(t *testing.T) {
+	server := &conditionalServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /allocation/compute", server.handler)
+	srv := newEndpointServer(t, mux)
+
+	registry := prometheus.NewRegistry()
+	logger := zerolog.Nop()
+	// The validator of the API headers matches, but no records are cached yet
+	cfg := conditionalConfig("USD", `If-None-Match:"v1"`)
+	e, err := New(cfg, Options{Registerer: registry, Logger: &logger, RESTConfig: &rest.Config{Host: srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.update(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := currencies(t, registry); !got["USD"] {
+		t.Errorf("exported currencies %v, want USD", got)
+	}
+	if got, want := server.requests(), []string{`"v1"`, ""}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("sent If-None-Match %q, want %q", got, want)
+	}
+}
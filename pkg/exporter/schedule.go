@@ -0,0 +1,48 @@
+package exporter
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/internal/schedule"
+)
+
+// scheduleFor returns the schedule of the scrapes of the configuration, or nil to sleep the polling
+// interval after each scrape.
+func scheduleFor(cfg Config) (schedule.Schedule, error) {
+	settings := cfg.Settings.Schedule
+	if settings.Cron == "" && !settings.Align {
+		return nil, nil
+	}
+
+	loc := time.UTC
+	if settings.Timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(settings.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading schedule timezone %s: %w", settings.Timezone, err)
+		}
+	}
+
+	if settings.Cron != "" {
+		return schedule.ParseCron(settings.Cron, loc)
+	}
+	interval := cfg.Scraper.Spec.ExporterConfig.PollingInterval.Duration
+	if interval <= 0 {
+		return nil, fmt.Errorf("aligned schedule requires a positive polling interval")
+	}
+	return schedule.Aligned{Interval: interval, Offset: settings.Offset, Location: loc}, nil
+}
+
+// nextScrape returns the start time of the next scrape after a scrape ending now.
+func nextScrape(cfg Config, sched schedule.Schedule, now time.Time) time.Time {
+	next := now.Add(cfg.Scraper.Spec.ExporterConfig.PollingInterval.Duration)
+	if sched != nil {
+		next = sched.Next(now)
+	}
+	if jitter := cfg.Settings.Schedule.Jitter; jitter > 0 {
+		next = next.Add(rand.N(jitter))
+	}
+	return next
+}
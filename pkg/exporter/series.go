@@ -0,0 +1,435 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/internal/openmetrics"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/internal/relabel"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/internal/utils"
+	configmetrics "github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/config"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes"
+)
+
+type recordGaugeCombo struct {
+	record        []string
+	name          string
+	labels        prometheus.Labels
+	value         float64
+	gauge         *timestampedGauge
+	thisIteration bool
+}
+
+// timestampedGauge is a gauge exported with the timestamp of its record, if any.
+type timestampedGauge struct {
+	prometheus.Gauge
+	mu        sync.Mutex
+	timestamp time.Time
+}
+
+func (g *timestampedGauge) SetTimestamp(timestamp time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.timestamp = timestamp
+}
+
+func (g *timestampedGauge) Timestamp() time.Time {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.timestamp
+}
+
+func (g *timestampedGauge) Collect(ch chan<- prometheus.Metric) {
+	timestamp := g.Timestamp()
+	if timestamp.IsZero() {
+		g.Gauge.Collect(ch)
+		return
+	}
+	ch <- prometheus.NewMetricWithTimestamp(timestamp, g.Gauge)
+}
+
+// backfillSnapshot holds the records of the last iteration with their own timestamps,
+// served by the backfill handler.
+type backfillSnapshot struct {
+	mu      sync.RWMutex
+	samples []openmetrics.Sample
+	log     zerolog.Logger
+}
+
+func (b *backfillSnapshot) set(samples []openmetrics.Sample) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.samples = samples
+}
+
+func (b *backfillSnapshot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.samples == nil {
+		http.Error(w, "backfill is not enabled", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", openmetrics.ContentType)
+	if err := openmetrics.Write(w, b.samples); err != nil {
+		b.log.Warn().Err(err).Msg("error while writing the backfill samples")
+	}
+}
+
+// seriesFor computes the metric name from the template and the namespace, then relabels the series.
+// It returns false if the series is dropped by the relabel configs.
+func (e *Exporter) seriesFor(name string, labels prometheus.Labels, series configmetrics.Series, nameTemplate *template.Template, rules []relabel.Rule) (string, prometheus.Labels, bool) {
+	if len(series.NameTemplate) > 0 {
+		var buf bytes.Buffer
+		err := nameTemplate.Execute(&buf, map[string]any{"name": name, "labels": map[string]string(labels)})
+		if err != nil {
+			e.log.Warn().Err(err).Msg("error while executing metric name template, using the default name")
+		} else {
+			name = buf.String()
+		}
+	}
+	if len(series.Namespace) > 0 {
+		name = series.Namespace + "_" + name
+	}
+
+	labels[relabel.MetricNameLabel] = name
+	relabeled, keep := relabel.Process(labels, rules)
+	if !keep {
+		return "", nil, false
+	}
+
+	name = relabel.SanitizeMetricName(relabeled[relabel.MetricNameLabel])
+	// As in Prometheus, the labels starting with __ (e.g. __tmp_*) are only available while relabeling
+	for label := range relabeled {
+		if strings.HasPrefix(label, "__") {
+			delete(relabeled, label)
+		}
+	}
+	return name, relabeled, true
+}
+
+// isTagsColumn tells whether the column holds tags, by default the columns whose name contains Tags.
+func isTagsColumn(column string, tags configmetrics.Tags) bool {
+	if len(tags.Columns) > 0 {
+		return slices.Contains(tags.Columns, column)
+	}
+	return strings.Contains(column, "Tags")
+}
+
+// tagLabelName returns the label of a tag key with the prefix, and the allowlisted key it matches, if any.
+func tagLabelName(key string, series configmetrics.Series) (string, bool) {
+	prefix := series.Tags.Prefix
+	if prefix == "" {
+		prefix = "tag_"
+	}
+
+	if len(series.Tags.Allowlist) > 0 {
+		i := slices.IndexFunc(series.Tags.Allowlist, func(allowed string) bool {
+			return strings.EqualFold(allowed, key)
+		})
+		if i < 0 {
+			return "", false
+		}
+		// The label of a tag does not depend on the case of its key in the records
+		key = series.Tags.Allowlist[i]
+	}
+	return relabel.SanitizeLabelNames([]string{prefix + key}, series.SnakeCaseLabels)[0], true
+}
+
+// tagLabelKeys returns the tag keys of each tag label found in the tags columns of all the records, or
+// of the allowlist, so that all the series have the same tag labels. The keys sanitized to the same
+// label (e.g. cost-center and cost_center) are sorted, the first one a record has is the value.
+func tagLabelKeys(records [][]string, tagsColumns []int, series configmetrics.Series) map[string][]string {
+	labelKeys := map[string][]string{}
+	for _, allowed := range series.Tags.Allowlist {
+		if label, ok := tagLabelName(allowed, series); ok {
+			labelKeys[label] = []string{}
+		}
+	}
+	for _, record := range records[1:] {
+		for _, j := range tagsColumns {
+			for key := range utils.ParseTags(record[j]) {
+				label, ok := tagLabelName(key, series)
+				if ok && !slices.Contains(labelKeys[label], key) {
+					labelKeys[label] = append(labelKeys[label], key)
+				}
+			}
+		}
+	}
+	for _, keys := range labelKeys {
+		slices.Sort(keys)
+	}
+	return labelKeys
+}
+
+// tagsToLabels returns the tag labels of a record, empty for the tags it does not have.
+func tagsToLabels(tags map[string]string, labelKeys map[string][]string) prometheus.Labels {
+	labels := prometheus.Labels{}
+	for label, keys := range labelKeys {
+		labels[label] = ""
+		for _, key := range keys {
+			if value, ok := tags[key]; ok {
+				labels[label] = value
+				break
+			}
+		}
+	}
+	return labels
+}
+
+// updateLabelMappingInfo exports the renamed columns through the info metric, if enabled.
+func (e *Exporter) updateLabelMappingInfo(registry prometheus.Registerer, info *prometheus.GaugeVec, labelMapping map[string]string, enabled bool) {
+	if !enabled {
+		registry.Unregister(info)
+		return
+	}
+
+	if err := registry.Register(info); err != nil {
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			e.log.Warn().Err(err).Msg("error while registering the label mapping metric")
+			return
+		}
+	}
+
+	info.Reset()
+	for column, label := range labelMapping {
+		info.WithLabelValues(column, label).Set(1)
+	}
+}
+
+// update scrapes the endpoint once and updates the exported series.
+func (e *Exporter) update(ctx context.Context, cfg Config) error {
+	config, exporter := cfg.Scraper, cfg.Settings
+	endpoint, err := e.resolveEndpoint(ctx, config, exporter)
+	if err != nil {
+		return fmt.Errorf("error while resolving endpoint: %w", err)
+	}
+	metricType, err := e.metricTypes.Get(config.Spec.ExporterConfig.MetricType)
+	if err != nil {
+		return &configError{err: fmt.Errorf("error while selecting the metric type: %w", err)}
+	}
+	src := metrictypes.Source{Config: config, Exporter: exporter}
+	scrapeStart := time.Now()
+	records, unchanged, err := e.scrapeRecords(ctx, config, exporter, endpoint, metricType, e.lastScrape)
+	if err != nil {
+		return fmt.Errorf("error while scraping records: %w", err)
+	}
+
+	e.seriesMu.Lock()
+	defer e.seriesMu.Unlock()
+
+	// The series exported from the same records with the same configuration are kept as they are
+	if unchanged && len(e.prometheusMetrics) > 0 && reflect.DeepEqual(cfg, e.published) {
+		e.log.Info().Msgf("Records unchanged, keeping the %d exported series", len(e.prometheusMetrics))
+		e.lastScrape = scrapeStart
+		e.mu.Lock()
+		e.snapshot.Time = scrapeStart
+		e.mu.Unlock()
+		e.snapshotStale.Set(0)
+		e.snapshotTimestamp.Set(float64(scrapeStart.Unix()))
+		return nil
+	}
+	// The names and labels of the series depend on the configuration, the series of a previous one are rebuilt
+	if !reflect.DeepEqual(cfg, e.published) {
+		for key, gaugeObj := range e.prometheusMetrics {
+			e.registerer.Unregister(gaugeObj.gauge)
+			delete(e.prometheusMetrics, key)
+		}
+	}
+
+	valueColumn := metricType.ValueColumn(src)
+	valueIndex, err := utils.GetIndexOf(records, valueColumn)
+	if err != nil {
+		return fmt.Errorf("error while selecting column %s: %w", valueColumn, err)
+	}
+
+	rules, err := relabel.Compile(exporter.Series.RelabelConfigs)
+	if err != nil {
+		return &configError{err: fmt.Errorf("error while compiling relabel configs: %w", err)}
+	}
+	nameTemplate, err := template.New("name").Parse(exporter.Series.NameTemplate)
+	if err != nil {
+		return &configError{err: fmt.Errorf("error while parsing metric name template: %w", err)}
+	}
+
+	labelNames := []string{}
+	if len(records) > 0 {
+		labelNames = relabel.SanitizeLabelNames(records[0], exporter.Series.SnakeCaseLabels)
+	}
+	labelMapping := map[string]string{}
+	for j, labelName := range labelNames {
+		if labelName != records[0][j] {
+			labelMapping[records[0][j]] = labelName
+		}
+	}
+	if !maps.Equal(labelMapping, e.previousLabelMapping) {
+		e.log.Info().Interface("mapping", labelMapping).Msg("columns renamed to valid label names")
+		e.previousLabelMapping = labelMapping
+	}
+	e.updateLabelMappingInfo(e.registerer, e.labelMappingInfo, labelMapping, exporter.Series.ExposeLabelMapping)
+
+	// Columns that are neither labels nor part of the series key
+	excludedColumns := map[int]bool{}
+	for j, column := range records[0] {
+		if !metricType.IsLabel(column, src) {
+			excludedColumns[j] = true
+		}
+	}
+	timestampIndex := -1
+	if exporter.Series.Timestamp.Column != "" {
+		timestampIndex, err = utils.GetIndexOf(records, exporter.Series.Timestamp.Column)
+		if err != nil {
+			return fmt.Errorf("error while selecting timestamp column %s: %w", exporter.Series.Timestamp.Column, err)
+		}
+		// The series of the records of different periods are the same, whatever their value
+		excludedColumns[valueIndex] = true
+		excludedColumns[timestampIndex] = true
+		for _, column := range exporter.Series.Timestamp.DropColumns {
+			if j, err := utils.GetIndexOf(records, column); err == nil {
+				excludedColumns[j] = true
+			}
+		}
+	}
+	tagsColumns := []int{}
+	for j, column := range records[0] {
+		if !excludedColumns[j] && isTagsColumn(column, exporter.Series.Tags) {
+			tagsColumns = append(tagsColumns, j)
+		}
+	}
+	var tagLabels map[string][]string
+	if exporter.Series.Tags.Expand {
+		tagLabels = tagLabelKeys(records, tagsColumns, exporter.Series)
+	}
+	backfillSamples := []openmetrics.Sample{}
+
+	e.log.Info().Msgf("Analyzing %d records...", len(records))
+	for i, record := range records {
+		// Skip header line
+		if i == 0 {
+			continue
+		}
+
+		metricValue, err := strconv.ParseFloat(record[valueIndex], 64)
+		if err != nil {
+			e.log.Warn().Err(err).Msgf("skipping this record for this iteration, error while parsing metric value: %s", record[valueIndex])
+			continue
+		}
+		var timestamp time.Time
+		if timestampIndex >= 0 {
+			timestamp, err = utils.ParseTime(record[timestampIndex], exporter.Series.Timestamp.Layout)
+			if err != nil {
+				e.log.Warn().Err(err).Msgf("skipping this record for this iteration, error while parsing timestamp: %s", record[timestampIndex])
+				continue
+			}
+		}
+
+		keyColumns := []string{}
+		for j, value := range record {
+			if !excludedColumns[j] {
+				keyColumns = append(keyColumns, value)
+			}
+		}
+		key := strings.Join(keyColumns, " ")
+
+		if gaugeObj, ok := e.prometheusMetrics[key]; ok {
+			// Only the latest record of each series is exported, the others are backfilled
+			if !gaugeObj.thisIteration || !timestamp.Before(gaugeObj.gauge.Timestamp()) {
+				gaugeObj.gauge.Set(metricValue)
+				gaugeObj.gauge.SetTimestamp(timestamp)
+				gaugeObj.value = metricValue
+				gaugeObj.thisIteration = true
+				e.prometheusMetrics[key] = gaugeObj
+			}
+			backfillSamples = append(backfillSamples, openmetrics.Sample{Name: gaugeObj.name, Labels: gaugeObj.labels, Value: metricValue, Timestamp: timestamp})
+			continue
+		}
+
+		labels := prometheus.Labels{}
+		tags := map[string]string{}
+		for j, value := range record {
+			if excludedColumns[j] {
+				continue
+			}
+			if !slices.Contains(tagsColumns, j) {
+				labels[labelNames[j]] = value
+			} else {
+				columnTags := utils.ParseTags(value)
+				if !exporter.Series.Tags.Expand || !exporter.Series.Tags.DropColumn {
+					labels[labelNames[j]] = utils.FlattenTags(columnTags)
+				}
+				maps.Copy(tags, columnTags)
+			}
+		}
+		// Tag labels never override the labels of the columns
+		for tagLabel, value := range tagsToLabels(tags, tagLabels) {
+			if _, ok := labels[tagLabel]; !ok {
+				labels[tagLabel] = value
+			}
+		}
+
+		name := metricType.MetricName(records[0], record, src)
+		name, labels, keep := e.seriesFor(name, labels, exporter.Series, nameTemplate, rules)
+		if !keep {
+			continue
+		}
+		newMetricsRow := &timestampedGauge{Gauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        name,
+			ConstLabels: labels,
+		})}
+		newMetricsRow.Set(metricValue)
+		newMetricsRow.SetTimestamp(timestamp)
+		// The series exported from the snapshot of the previous leader are replaced without gaps
+		e.dropFollowerSeries(seriesID(name, labels))
+		if err := e.registerer.Register(newMetricsRow); err != nil {
+			e.log.Warn().Err(err).Msgf("skipping this record, error while registering metric %s", name)
+			continue
+		}
+		e.prometheusMetrics[key] = recordGaugeCombo{record: record, name: name, labels: labels, value: metricValue, gauge: newMetricsRow, thisIteration: true}
+		backfillSamples = append(backfillSamples, openmetrics.Sample{Name: name, Labels: labels, Value: metricValue, Timestamp: timestamp})
+	}
+	if exporter.Series.Timestamp.Backfill {
+		e.backfill.set(backfillSamples)
+	} else {
+		e.backfill.set(nil)
+	}
+
+	for key, gaugeObj := range e.prometheusMetrics {
+		if !gaugeObj.thisIteration {
+			e.registerer.Unregister(gaugeObj.gauge)
+			delete(e.prometheusMetrics, key)
+		} else {
+			gaugeObj.thisIteration = false
+			e.prometheusMetrics[key] = gaugeObj
+		}
+	}
+	if len(records) > 0 {
+		e.lastScrape = scrapeStart
+	}
+
+	e.dropFollowerSeries("")
+
+	series := make([]Series, 0, len(e.prometheusMetrics))
+	for _, gaugeObj := range e.prometheusMetrics {
+		series = append(series, Series{Name: gaugeObj.name, Labels: gaugeObj.labels, Value: gaugeObj.value, Timestamp: gaugeObj.gauge.Timestamp()})
+	}
+	e.mu.Lock()
+	e.snapshot = Snapshot{Time: scrapeStart, Records: records, Series: series}
+	e.mu.Unlock()
+	e.published = cfg
+	e.snapshotStale.Set(0)
+	e.snapshotTimestamp.Set(float64(scrapeStart.Unix()))
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+
+	configmetrics "github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/config"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes/focus"
+)
+
+// newReportServer mocks an endpoint serving a FOCUS report as CSV.
+func newReportServer(t *testing.T, report string) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /report", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte(report))
+	})
+	return newEndpointServer(t, mux)
+}
+
+func reportConfig(settings configmetrics.Exporter) Config {
+	cfg := Config{Settings: settings}
+	cfg.Scraper.Spec.ExporterConfig.MetricType = focus.Name
+	cfg.Scraper.Spec.ExporterConfig.PollingInterval = metav1.Duration{Duration: time.Hour}
+	cfg.Scraper.Spec.ExporterConfig.API = finopsdatatypes.API{
+		Path:        "/report",
+		Verb:        http.MethodGet,
+		EndpointRef: &finopsdatatypes.ObjectRef{Name: "opencost", Namespace: "finops"},
+	}
+	return cfg
+}
+
+func TestUpdateExpandedTags(t *testing.T) {
+	report := "BilledCost,ResourceId,Tags\n" +
+		`1,vm-1,"{""team"":""a"",""env"":""prod""}"` + "\n" +
+		`2,vm-2,"{""team"":""b""}"` + "\n" +
+		"3,vm-3,\n" +
+		`4,vm-4,"{""cost_center"":""y"",""cost-center"":""x""}"` + "\n"
+
+	tests := []struct {
+		name string
+		tags configmetrics.Tags
+		want map[string]float64
+	}{
+		{
+			name: "union of the tags",
+			tags: configmetrics.Tags{Expand: true, DropColumn: true},
+			want: map[string]float64{
+				`billed_cost{BilledCost="1",ResourceId="vm-1",tag_cost_center="",tag_env="prod",tag_team="a"}`: 1,
+				`billed_cost{BilledCost="2",ResourceId="vm-2",tag_cost_center="",tag_env="",tag_team="b"}`:     2,
+				`billed_cost{BilledCost="3",ResourceId="vm-3",tag_cost_center="",tag_env="",tag_team=""}`:      3,
+				// cost-center and cost_center are the same label, cost-center sorts first
+				`billed_cost{BilledCost="4",ResourceId="vm-4",tag_cost_center="x",tag_env="",tag_team=""}`: 4,
+			},
+		},
+		{
+			name: "allowlist",
+			tags: configmetrics.Tags{Expand: true, DropColumn: true, Allowlist: []string{"Team", "owner"}},
+			want: map[string]float64{
+				`billed_cost{BilledCost="1",ResourceId="vm-1",tag_Team="a",tag_owner=""}`: 1,
+				`billed_cost{BilledCost="2",ResourceId="vm-2",tag_Team="b",tag_owner=""}`: 2,
+				`billed_cost{BilledCost="3",ResourceId="vm-3",tag_Team="",tag_owner=""}`:  3,
+				`billed_cost{BilledCost="4",ResourceId="vm-4",tag_Team="",tag_owner=""}`:  4,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newReportServer(t, report)
+			cfg := reportConfig(configmetrics.Exporter{Series: configmetrics.Series{Tags: tt.tags}})
+
+			registry := prometheus.NewRegistry()
+			logger := zerolog.Nop()
+			e, err := New(cfg, Options{Registerer: registry, Logger: &logger, RESTConfig: &rest.Config{Host: srv.URL}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := e.update(context.Background(), cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			got := gatherSeries(t, registry)
+			for series := range got {
+				if !strings.HasPrefix(series, "billed_cost{") {
+					delete(got, series)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	ReasonScrapeSucceeded = "ScrapeSucceeded"
+	ReasonScrapeFailed    = "ScrapeFailed"
+	ReasonScrapeRecovered = "ScrapeRecovered"
+	ReasonConfigError     = "ConfigError"
+)
+
+// StatusOptions writes the outcome of the scrapes to the status of the ExporterScraperConfig.
+type StatusOptions struct {
+	// Client updates the status subresource.
+	Client dynamic.Interface
+	// Recorder, if set, emits Events on configuration errors and repeated scrape failures.
+	Recorder record.EventRecorder
+	// Namespace and Name of the ExporterScraperConfig, by default the ones of the configuration (set when watching).
+	Namespace string
+	Name      string
+	// FailureThreshold is the number of consecutive failed scrapes an Event is emitted after (3 by default).
+	FailureThreshold int
+}
+
+// configError is a scrape error caused by the configuration rather than by the endpoint.
+type configError struct {
+	err error
+}
+
+func (e *configError) Error() string {
+	return e.err.Error()
+}
+
+func (e *configError) Unwrap() error {
+	return e.err
+}
+
+// scrapeResult is the outcome of a scrape, reported to the status.
+type scrapeResult struct {
+	time    time.Time
+	err     error
+	records int
+	series  int
+}
+
+// reportStatus updates the Ready condition of the ExporterScraperConfig,
+// and emits Events on configuration errors and after FailureThreshold consecutive failures.
+func (e *Exporter) reportStatus(ctx context.Context, cfg Config, result scrapeResult) {
+	opts := e.opts.Status
+	if opts == nil {
+		return
+	}
+
+	namespace, name := opts.Namespace, opts.Name
+	if name == "" {
+		namespace, name = cfg.Scraper.GetNamespace(), cfg.Scraper.GetName()
+	}
+	if name == "" {
+		e.log.Debug().Msg("no ExporterScraperConfig to report the status to")
+		return
+	}
+
+	previousFailures := e.failures
+	if result.err != nil {
+		e.failures++
+	} else {
+		e.failures = 0
+	}
+
+	if opts.Recorder != nil {
+		threshold := opts.FailureThreshold
+		if threshold <= 0 {
+			threshold = 3
+		}
+		ref := &corev1.ObjectReference{
+			APIVersion: ExporterScraperConfigResource.GroupVersion().String(),
+			Kind:       "ExporterScraperConfig",
+			Namespace:  namespace,
+			Name:       name,
+		}
+
+		var cfgErr *configError
+		switch {
+		case errors.As(result.err, &cfgErr) && previousFailures == 0:
+			opts.Recorder.Event(ref, corev1.EventTypeWarning, ReasonConfigError, result.err.Error())
+		case result.err != nil && e.failures == threshold:
+			opts.Recorder.Eventf(ref, corev1.EventTypeWarning, ReasonScrapeFailed, "%d consecutive scrapes failed: %s", e.failures, result.err.Error())
+		case result.err == nil && previousFailures >= threshold:
+			opts.Recorder.Eventf(ref, corev1.EventTypeNormal, ReasonScrapeRecovered, "scrape succeeded after %d failures", previousFailures)
+		}
+	}
+
+	if opts.Client == nil {
+		return
+	}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cli := opts.Client.Resource(ExporterScraperConfigResource).Namespace(namespace)
+		obj, err := cli.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		err = setStatus(obj, result)
+		if err != nil {
+			return err
+		}
+		_, err = cli.UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		e.log.Warn().Err(err).Msgf("error while updating the status of ExporterScraperConfig %s/%s", namespace, name)
+	}
+}
+
+// setStatus sets the Ready condition, keeping the other conditions. The ExporterScraperConfig status
+// only defines the conditions, the outcome of the scrape is reported in the message.
+func setStatus(obj *unstructured.Unstructured, result scrapeResult) error {
+	now := result.time.UTC().Format(time.RFC3339)
+	condition := map[string]any{
+		"type":    "Ready",
+		"status":  string(metav1.ConditionTrue),
+		"reason":  ReasonScrapeSucceeded,
+		"message": fmt.Sprintf("%d records exported as %d series, scraped at %s", result.records, result.series, now),
+	}
+	var cfgErr *configError
+	if errors.As(result.err, &cfgErr) {
+		condition["status"] = string(metav1.ConditionFalse)
+		condition["reason"] = ReasonConfigError
+		condition["message"] = result.err.Error()
+	} else if result.err != nil {
+		condition["status"] = string(metav1.ConditionFalse)
+		condition["reason"] = ReasonScrapeFailed
+		condition["message"] = fmt.Sprintf("scrape at %s failed: %s", now, result.err.Error())
+	}
+
+	conditions, _, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil {
+		return err
+	}
+	condition["lastTransitionTime"] = now
+	found := false
+	for i, c := range conditions {
+		existing, ok := c.(map[string]any)
+		if !ok || existing["type"] != "Ready" {
+			continue
+		}
+		if existing["status"] == condition["status"] {
+			if lastTransitionTime, ok := existing["lastTransitionTime"]; ok {
+				condition["lastTransitionTime"] = lastTransitionTime
+			}
+		}
+		conditions[i] = condition
+		found = true
+	}
+	if !found {
+		conditions = append(conditions, condition)
+	}
+
+	return unstructured.SetNestedSlice(obj.Object, conditions, "status", "conditions")
+}
@@ -0,0 +1,150 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+
+	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+	configmetrics "github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/config"
+)
+
+// ExporterScraperConfigResource is the resource of the ExporterScraperConfig custom resources.
+var ExporterScraperConfigResource = schema.GroupVersionResource{Group: "finops.krateo.io", Version: "v1", Resource: "exporterscraperconfigs"}
+
+// WatchOptions selects the ExporterScraperConfig the exporter is configured from.
+type WatchOptions struct {
+	// Client reads the custom resources, e.g. dynamic.NewForConfig or the fake dynamic client.
+	Client dynamic.Interface
+	// Namespace of the custom resources (all namespaces if empty).
+	Namespace string
+	// Name selects the custom resource by name.
+	Name string
+	// LabelSelector selects the custom resources by label, the first one by namespace and name is used.
+	LabelSelector string
+	// Resync is the period of the full resyncs of the informer (10m by default).
+	Resync time.Duration
+}
+
+// Watch configures the exporter from the selected ExporterScraperConfig and reconfigures it
+// whenever the custom resource changes, until the context is canceled.
+func (e *Exporter) Watch(ctx context.Context, opts WatchOptions) error {
+	if opts.Client == nil {
+		return fmt.Errorf("a dynamic client is required to watch ExporterScraperConfig resources")
+	}
+	if opts.Name == "" && opts.LabelSelector == "" {
+		return fmt.Errorf("a name or a label selector is required to watch ExporterScraperConfig resources")
+	}
+	resync := opts.Resync
+	if resync == 0 {
+		resync = 10 * time.Minute
+	}
+
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(opts.Client, resync, opts.Namespace, func(lo *metav1.ListOptions) {
+		lo.LabelSelector = opts.LabelSelector
+	})
+	informer := factory.ForResource(ExporterScraperConfigResource).Informer()
+
+	// The missing settings are reported once, not on every reconfiguration
+	settingsWarned := false
+	apply := func() {
+		obj, err := selectConfigObject(informer.GetStore().List(), opts)
+		if err != nil {
+			// The resource is deleted, or not created yet
+			e.log.Warn().Err(err).Msg("stopping the scrapes until an ExporterScraperConfig matches")
+			e.ClearConfig()
+			return
+		}
+		cfg, err := ConfigFromObject(obj)
+		if err != nil {
+			e.log.Error().Err(err).Msgf("error while reading ExporterScraperConfig %s/%s", obj.GetNamespace(), obj.GetName())
+			return
+		}
+		if e.SetConfig(cfg) {
+			e.log.Info().Msgf("configuration updated from ExporterScraperConfig %s/%s", obj.GetNamespace(), obj.GetName())
+			// The ExporterScraperConfig type does not define the exporter settings, a CRD generated from
+			// it prunes them and the exporter runs without them
+			if reflect.ValueOf(cfg.Settings).IsZero() && !settingsWarned {
+				settingsWarned = true
+				e.log.Warn().Msgf("ExporterScraperConfig %s/%s has no exporter settings in spec.exporterConfig, running with the defaults: if any are set (http, fanOut, series, mapping, schedule, debug, ...), the installed CRD prunes them", obj.GetNamespace(), obj.GetName())
+			}
+		}
+	}
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { apply() },
+		UpdateFunc: func(any, any) { apply() },
+		DeleteFunc: func(any) { apply() },
+	})
+	if err != nil {
+		return err
+	}
+
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return fmt.Errorf("error while syncing the ExporterScraperConfig cache: %w", ctx.Err())
+	}
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// selectConfigObject returns the selected custom resource, the first one by namespace and name.
+func selectConfigObject(objs []any, opts WatchOptions) (*unstructured.Unstructured, error) {
+	selected := []*unstructured.Unstructured{}
+	for _, obj := range objs {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok || (opts.Name != "" && u.GetName() != opts.Name) {
+			continue
+		}
+		selected = append(selected, u)
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no ExporterScraperConfig matches name %q and label selector %q", opts.Name, opts.LabelSelector)
+	}
+
+	sort.Slice(selected, func(i, j int) bool {
+		if selected[i].GetNamespace() != selected[j].GetNamespace() {
+			return selected[i].GetNamespace() < selected[j].GetNamespace()
+		}
+		return selected[i].GetName() < selected[j].GetName()
+	})
+	return selected[0], nil
+}
+
+// ConfigFromObject reads the configuration from an ExporterScraperConfig custom resource.
+// The exporter settings are read from spec.exporterConfig, as in the configuration file.
+func ConfigFromObject(obj *unstructured.Unstructured) (Config, error) {
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return Config{}, err
+	}
+
+	scraper := finopsdatatypes.ExporterScraperConfig{}
+	err = json.Unmarshal(data, &scraper)
+	if err != nil {
+		return Config{}, err
+	}
+	// Only the identity of the resource is kept, so that status updates and metadata changes do not
+	// count as configuration changes
+	scraper.ObjectMeta = metav1.ObjectMeta{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	scraper.Status = finopsdatatypes.ExporterScraperConfigStatus{}
+
+	// JSON is valid YAML, the settings keep their YAML field names
+	settings, err := configmetrics.ParseExporter(data)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return Config{Scraper: scraper, Settings: settings}, nil
+}
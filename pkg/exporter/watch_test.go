@@ -0,0 +1,146 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
+)
+
+func newConfigObject(name, pollingInterval string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "finops.krateo.io/v1",
+		"kind":       "ExporterScraperConfig",
+		"metadata":   map[string]any{"name": name, "namespace": "finops"},
+		"spec": map[string]any{
+			"exporterConfig": map[string]any{
+				"metricType":      "opencost",
+				"pollingInterval": pollingInterval,
+				"api": map[string]any{
+					"path":        "/allocation/compute?window=1d",
+					"verb":        http.MethodGet,
+					"endpointRef": map[string]any{"name": "opencost", "namespace": "finops"},
+				},
+			},
+		},
+	}}
+}
+
+// eventually polls the condition until it holds or a few seconds pass.
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	srv := newOpenCostServer(t)
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		ExporterScraperConfigResource: "ExporterScraperConfigList",
+	})
+	resources := client.Resource(ExporterScraperConfigResource).Namespace("finops")
+
+	registry := prometheus.NewRegistry()
+	logger := zerolog.Nop()
+	e, err := New(Config{}, Options{Registerer: registry, Logger: &logger, RESTConfig: &rest.Config{Host: srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- e.Watch(ctx, WatchOptions{Client: client, Namespace: "finops", Name: "opencost"}) }()
+
+	config := func() (Config, bool) {
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+		return e.config, e.configured
+	}
+	seriesCount := func() int {
+		e.seriesMu.Lock()
+		defer e.seriesMu.Unlock()
+		return len(e.prometheusMetrics)
+	}
+
+	// Added: the exporter is configured from the resource and scrapes it
+	if _, err := resources.Create(ctx, newConfigObject("opencost", "1h"), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the configuration of the created resource", func() bool {
+		cfg, configured := config()
+		return configured && cfg.Scraper.Spec.ExporterConfig.PollingInterval.Duration == time.Hour
+	})
+	if cfg, _ := config(); cfg.Scraper.Name != "opencost" || cfg.Scraper.Namespace != "finops" {
+		t.Errorf("configured from %s/%s, want finops/opencost", cfg.Scraper.Namespace, cfg.Scraper.Name)
+	}
+	if result, _ := e.cycle(ctx); result.err != nil {
+		t.Fatal(result.err)
+	}
+	if seriesCount() == 0 {
+		t.Fatal("no series exported")
+	}
+
+	// Another resource that does not match is ignored
+	if _, err := resources.Create(ctx, newConfigObject("other", "5m"), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Updated: the exporter is reconfigured
+	if _, err := resources.Update(ctx, newConfigObject("opencost", "30m"), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the configuration of the updated resource", func() bool {
+		cfg, configured := config()
+		return configured && cfg.Scraper.Spec.ExporterConfig.PollingInterval.Duration == 30*time.Minute
+	})
+
+	// Deleted: the exporter stops scraping and exporting the series
+	if err := resources.Delete(ctx, "opencost", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the configuration to be removed", func() bool {
+		_, configured := config()
+		return !configured
+	})
+	if result, _ := e.cycle(ctx); result.err == nil {
+		t.Error("expected no configuration after the deletion")
+	}
+	if n := seriesCount(); n != 0 {
+		t.Errorf("%d series still exported after the deletion", n)
+	}
+	if snapshot := e.Snapshot(); len(snapshot.Series) != 0 {
+		t.Errorf("%d series still in the snapshot after the deletion", len(snapshot.Series))
+	}
+
+	cancel()
+	<-done
+}
+
+func TestWatchRequiresSelection(t *testing.T) {
+	e, err := New(Config{}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	if err := e.Watch(context.Background(), WatchOptions{Client: client}); err == nil {
+		t.Error("expected an error without a name or a label selector")
+	}
+	if err := e.Watch(context.Background(), WatchOptions{Name: "opencost"}); err == nil {
+		t.Error("expected an error without a client")
+	}
+}
@@ -0,0 +1,92 @@
+// Package azure implements the resource metric type, for Azure Monitor metrics responses.
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/config"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes"
+)
+
+const Name = "resource"
+
+type MetricType struct{}
+
+func New() *MetricType {
+	return &MetricType{}
+}
+
+// Decode exports a record for each aggregation of each sample, with a column for each
+// dimension of the timeseries.
+func (*MetricType) Decode(byteData []byte, _ string, src metrictypes.Source) ([][]string, error) {
+	data := config.Metrics{}
+	err := json.Unmarshal(byteData, &data)
+	if err != nil {
+		if e, ok := err.(*json.SyntaxError); ok {
+			return nil, fmt.Errorf("error decoding response, syntax error at byte offset %d: %w", e.Offset, err)
+		}
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	// The dimensions of all the timeseries become columns, empty where a timeseries lacks them
+	dimensions := []string{}
+	for _, value := range data.Value {
+		for _, timeseries := range value.Timeseries {
+			for _, metadata := range timeseries.MetadataValues {
+				if !slices.Contains(dimensions, metadata.Name.Value) {
+					dimensions = append(dimensions, metadata.Name.Value)
+				}
+			}
+		}
+	}
+	sort.Strings(dimensions)
+
+	records := [][]string{append([]string{"ResourceId", "metricName", "timestamp", "aggregation", "value", "unit"}, dimensions...)}
+	for _, value := range data.Value {
+		for _, timeseries := range value.Timeseries {
+			dimensionValues := make([]string, len(dimensions))
+			for _, metadata := range timeseries.MetadataValues {
+				dimensionValues[slices.Index(dimensions, metadata.Name.Value)] = metadata.Value
+			}
+			for _, metric := range timeseries.Data {
+				aggregations := metric.Aggregations()
+				for _, aggregation := range slices.Sorted(maps.Keys(aggregations)) {
+					record := []string{
+						src.Config.Spec.ExporterConfig.AdditionalVariables["ResourceId"],
+						value.Name.Value,
+						metric.Timestamp.Format(time.RFC3339),
+						aggregation,
+						aggregations[aggregation].AsDec().String(),
+						value.Unit,
+					}
+					records = append(records, append(record, dimensionValues...))
+				}
+			}
+		}
+	}
+
+	return records, nil
+}
+
+func (*MetricType) ValueColumn(_ metrictypes.Source) string {
+	return "value"
+}
+
+func (t *MetricType) IsLabel(column string, src metrictypes.Source) bool {
+	return !strings.EqualFold(column, t.ValueColumn(src))
+}
+
+// MetricName is the name of the Azure metric, e.g. percentage_cpu.
+func (*MetricType) MetricName(header []string, record []string, _ metrictypes.Source) string {
+	i := slices.Index(header, "metricName")
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return strings.ReplaceAll(strings.ToLower(record[i]), " ", "_")
+}
@@ -0,0 +1,105 @@
+package azure
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes"
+)
+
+func source(resourceID string) metrictypes.Source {
+	src := metrictypes.Source{}
+	src.Config.Spec.ExporterConfig.AdditionalVariables = map[string]string{"ResourceId": resourceID}
+	return src
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    [][]string
+		wantErr bool
+	}{
+		{
+			name: "aggregations",
+			data: `{"value":[{"name":{"value":"Percentage CPU"},"unit":"Percent","timeseries":[{"data":[{"timeStamp":"2025-01-01T00:00:00Z","average":1.5,"maximum":3}]}]}]}`,
+			want: [][]string{
+				{"ResourceId", "metricName", "timestamp", "aggregation", "value", "unit"},
+				{"vm-1", "Percentage CPU", "2025-01-01T00:00:00Z", "average", "1.5", "Percent"},
+				{"vm-1", "Percentage CPU", "2025-01-01T00:00:00Z", "maximum", "3", "Percent"},
+			},
+		},
+		{
+			name: "dimensions",
+			data: `{"value":[{"name":{"value":"Transactions"},"unit":"Count","timeseries":[` +
+				`{"metadatavalues":[{"name":{"value":"ApiName"},"value":"GetBlob"}],"data":[{"timeStamp":"2025-01-01T00:00:00Z","total":4}]},` +
+				`{"metadatavalues":[{"name":{"value":"Authentication"},"value":"SAS"}],"data":[{"timeStamp":"2025-01-01T00:00:00Z","total":2}]}]}]}`,
+			want: [][]string{
+				{"ResourceId", "metricName", "timestamp", "aggregation", "value", "unit", "ApiName", "Authentication"},
+				{"vm-1", "Transactions", "2025-01-01T00:00:00Z", "total", "4", "Count", "GetBlob", ""},
+				{"vm-1", "Transactions", "2025-01-01T00:00:00Z", "total", "2", "Count", "", "SAS"},
+			},
+		},
+		{
+			name:    "syntax error",
+			data:    `{"value":[`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := New().Decode([]byte(tt.data), "application/json", source("vm-1"))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(records, tt.want) {
+				t.Errorf("got %v, want %v", records, tt.want)
+			}
+		})
+	}
+}
+
+func TestColumns(t *testing.T) {
+	metricType := New()
+	src := metrictypes.Source{}
+	if got := metricType.ValueColumn(src); got != "value" {
+		t.Errorf("ValueColumn() = %q, want value", got)
+	}
+
+	labels := []struct {
+		column string
+		want   bool
+	}{
+		{column: "ResourceId", want: true},
+		{column: "aggregation", want: true},
+		{column: "value", want: false},
+		{column: "Value", want: false},
+	}
+	for _, tt := range labels {
+		if got := metricType.IsLabel(tt.column, src); got != tt.want {
+			t.Errorf("IsLabel(%q) = %v, want %v", tt.column, got, tt.want)
+		}
+	}
+
+	names := []struct {
+		header []string
+		record []string
+		want   string
+	}{
+		{header: []string{"ResourceId", "metricName"}, record: []string{"vm-1", "Percentage CPU"}, want: "percentage_cpu"},
+		{header: []string{"ResourceId"}, record: []string{"vm-1"}, want: ""},
+		{header: []string{"ResourceId", "metricName"}, record: []string{"vm-1"}, want: ""},
+	}
+	for _, tt := range names {
+		if got := metricType.MetricName(tt.header, tt.record, src); got != tt.want {
+			t.Errorf("MetricName(%v, %v) = %q, want %q", tt.header, tt.record, got, tt.want)
+		}
+	}
+}
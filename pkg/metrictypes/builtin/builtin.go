@@ -0,0 +1,20 @@
+// Package builtin registers the metric types shipped with the exporter.
+package builtin
+
+import (
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes/azure"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes/focus"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes/jsonmap"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes/opencost"
+)
+
+// NewRegistry returns a registry with the cost, resource, opencost and json metric types.
+func NewRegistry() *metrictypes.Registry {
+	registry := metrictypes.NewRegistry()
+	registry.Register(focus.Name, focus.New())
+	registry.Register(azure.Name, azure.New())
+	registry.Register(opencost.Name, opencost.New())
+	registry.Register(jsonmap.Name, jsonmap.New())
+	return registry
+}
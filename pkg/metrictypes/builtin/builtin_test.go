@@ -0,0 +1,12 @@
+package builtin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewRegistry(t *testing.T) {
+	if got, want := NewRegistry().Names(), []string{"cost", "json", "opencost", "resource"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,46 @@
+// Package focus implements the cost metric type, for FOCUS reports as CSV or as FocusConfig lists.
+package focus
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/internal/utils"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes"
+)
+
+const Name = "cost"
+
+type MetricType struct{}
+
+func New() *MetricType {
+	return &MetricType{}
+}
+
+func (*MetricType) Decode(data []byte, contentType string, _ metrictypes.Source) ([][]string, error) {
+	if contentType == "application/json" {
+		var err error
+		data, err = utils.TryParseResponseAsFocusJSON(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.LazyQuotes = true
+	return reader.ReadAll()
+}
+
+func (*MetricType) ValueColumn(_ metrictypes.Source) string {
+	return "BilledCost"
+}
+
+// IsLabel excludes the x_ extension columns of the FOCUS specification.
+func (*MetricType) IsLabel(column string, _ metrictypes.Source) bool {
+	return !strings.Contains(column, "x_")
+}
+
+func (*MetricType) MetricName(_ []string, _ []string, _ metrictypes.Source) string {
+	return "billed_cost"
+}
@@ -0,0 +1,92 @@
+package focus
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		contentType string
+		column      string
+		want        []string
+		wantErr     bool
+	}{
+		{
+			name:        "csv",
+			data:        "BilledCost,ResourceId,Tags\n1.5,vm-1,\"{\"\"env\"\":\"\"prod\"\"}\"\n2,vm-2,\n",
+			contentType: "text/csv",
+			column:      "Tags",
+			want:        []string{`{"env":"prod"}`, ""},
+		},
+		{
+			name:        "focus config list",
+			data:        `{"items":[{"spec":{"focusSpec":{"billedCost":"1.5","resourceId":"vm-1"}}},{"spec":{"focusSpec":{"billedCost":"2","resourceId":"vm-2"}}}]}`,
+			contentType: "application/json",
+			column:      "ResourceId",
+			want:        []string{"vm-1", "vm-2"},
+		},
+		{
+			name:        "invalid json",
+			data:        `{"items":`,
+			contentType: "application/json",
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := New().Decode([]byte(tt.data), tt.contentType, metrictypes.Source{})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != len(tt.want)+1 {
+				t.Fatalf("got %d records, want %d", len(records), len(tt.want)+1)
+			}
+			i := slices.Index(records[0], tt.column)
+			if i < 0 {
+				t.Fatalf("column %s not found in %v", tt.column, records[0])
+			}
+			for j, want := range tt.want {
+				if got := records[j+1][i]; got != want {
+					t.Errorf("record %d: got %q, want %q", j+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestColumns(t *testing.T) {
+	metricType := New()
+	if got := metricType.ValueColumn(metrictypes.Source{}); got != "BilledCost" {
+		t.Errorf("ValueColumn() = %q, want BilledCost", got)
+	}
+	if got := metricType.MetricName(nil, nil, metrictypes.Source{}); got != "billed_cost" {
+		t.Errorf("MetricName() = %q, want billed_cost", got)
+	}
+
+	tests := []struct {
+		column string
+		want   bool
+	}{
+		{column: "ResourceId", want: true},
+		{column: "BilledCost", want: true},
+		{column: "x_ResourceType", want: false},
+		{column: "x_CostComponent", want: false},
+	}
+	for _, tt := range tests {
+		if got := metricType.IsLabel(tt.column, metrictypes.Source{}); got != tt.want {
+			t.Errorf("IsLabel(%q) = %v, want %v", tt.column, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+// Package jsonmap implements the json metric type, mapping arbitrary JSON responses to records with JSONPath.
+package jsonmap
+
+import (
+	"strings"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/internal/utils"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes"
+)
+
+const Name = "json"
+
+type MetricType struct{}
+
+func New() *MetricType {
+	return &MetricType{}
+}
+
+func (*MetricType) Decode(data []byte, _ string, src metrictypes.Source) ([][]string, error) {
+	return utils.MapJSONRecords(data, src.Exporter.Mapping)
+}
+
+func (*MetricType) ValueColumn(src metrictypes.Source) string {
+	return src.Exporter.Mapping.ValueColumn
+}
+
+// IsLabel excludes the value, so that series survive value changes.
+func (t *MetricType) IsLabel(column string, src metrictypes.Source) bool {
+	return !strings.EqualFold(column, t.ValueColumn(src))
+}
+
+func (*MetricType) MetricName(_ []string, _ []string, src metrictypes.Source) string {
+	return src.Exporter.Mapping.MetricName
+}
@@ -0,0 +1,101 @@
+package jsonmap
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/config"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes"
+)
+
+func source(mapping config.Mapping) metrictypes.Source {
+	return metrictypes.Source{Exporter: config.Exporter{Mapping: mapping}}
+}
+
+func TestDecode(t *testing.T) {
+	columns := []config.MappingColumn{
+		{Name: "service", Path: "{.name}"},
+		{Name: "cost", Path: ".cost"},
+		{Name: "currency", Path: "$.currency"},
+	}
+	tests := []struct {
+		name    string
+		data    string
+		mapping config.Mapping
+		want    [][]string
+		wantErr bool
+	}{
+		{
+			name:    "row items",
+			data:    `{"currency":"EUR","rows":[{"name":"vm","cost":1.5},{"name":"storage","cost":2}]}`,
+			mapping: config.Mapping{Rows: "{.rows[*]}", Columns: columns},
+			want:    [][]string{{"service", "cost", "currency"}, {"vm", "1.5", "EUR"}, {"storage", "2", "EUR"}},
+		},
+		{
+			name:    "row array",
+			data:    `{"currency":"EUR","rows":[{"name":"vm","cost":1.5}]}`,
+			mapping: config.Mapping{Rows: ".rows", Columns: columns},
+			want:    [][]string{{"service", "cost", "currency"}, {"vm", "1.5", "EUR"}},
+		},
+		{
+			name:    "no rows",
+			data:    `{"rows":[]}`,
+			mapping: config.Mapping{Rows: "{.rows[*]}", Columns: columns[:2]},
+			want:    [][]string{{"service", "cost"}},
+		},
+		{
+			name:    "missing mapping",
+			data:    `{}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid json",
+			data:    `{"rows":`,
+			mapping: config.Mapping{Rows: "{.rows[*]}", Columns: columns},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := New().Decode([]byte(tt.data), "application/json", source(tt.mapping))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(records, tt.want) {
+				t.Errorf("got %v, want %v", records, tt.want)
+			}
+		})
+	}
+}
+
+func TestColumns(t *testing.T) {
+	metricType := New()
+	src := source(config.Mapping{ValueColumn: "cost", MetricName: "service_cost"})
+	if got := metricType.ValueColumn(src); got != "cost" {
+		t.Errorf("ValueColumn() = %q, want cost", got)
+	}
+	if got := metricType.MetricName(nil, nil, src); got != "service_cost" {
+		t.Errorf("MetricName() = %q, want service_cost", got)
+	}
+
+	tests := []struct {
+		column string
+		want   bool
+	}{
+		{column: "service", want: true},
+		{column: "cost", want: false},
+		{column: "Cost", want: false},
+	}
+	for _, tt := range tests {
+		if got := metricType.IsLabel(tt.column, src); got != tt.want {
+			t.Errorf("IsLabel(%q) = %v, want %v", tt.column, got, tt.want)
+		}
+	}
+}
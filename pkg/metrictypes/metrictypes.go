@@ -0,0 +1,81 @@
+package metrictypes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/config"
+)
+
+// Source is the configuration a metric type decodes its responses with.
+type Source struct {
+	Config   finopsdatatypes.ExporterScraperConfig
+	Exporter config.Exporter
+}
+
+// MetricType turns the responses of an endpoint into records and describes how they are exported.
+type MetricType interface {
+	// Decode turns a response into records, the first record being the header.
+	// The content type is the media type of the response, e.g. text/csv.
+	Decode(data []byte, contentType string, src Source) ([][]string, error)
+	// ValueColumn is the name of the column holding the value of the records.
+	ValueColumn(src Source) string
+	// IsLabel reports whether a column of the records is exported as a label.
+	IsLabel(column string, src Source) bool
+	// MetricName is the default name of the series of a record.
+	MetricName(header []string, record []string, src Source) string
+}
+
+// Registry holds the metric types by name, the MetricType of the ExporterScraperConfig.
+type Registry struct {
+	mu    sync.RWMutex
+	types map[string]MetricType
+}
+
+func NewRegistry() *Registry {
+	return &Registry{types: map[string]MetricType{}}
+}
+
+// Register adds a metric type, names are case insensitive.
+func (r *Registry) Register(name string, metricType MetricType) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name = strings.ToLower(name)
+	if _, ok := r.types[name]; ok {
+		return fmt.Errorf("metric type %s already registered", name)
+	}
+	r.types[name] = metricType
+	return nil
+}
+
+// Get returns the metric type with the given name.
+func (r *Registry) Get(name string) (MetricType, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	metricType, ok := r.types[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric type %q, must be one of %s", name, strings.Join(r.names(), ", "))
+	}
+	return metricType, nil
+}
+
+// Names returns the names of the registered metric types, sorted.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.names()
+}
+
+func (r *Registry) names() []string {
+	names := make([]string, 0, len(r.types))
+	for name := range r.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
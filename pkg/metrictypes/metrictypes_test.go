@@ -0,0 +1,57 @@
+package metrictypes
+
+import (
+	"reflect"
+	"testing"
+)
+
+type stubMetricType struct{ name string }
+
+func (*stubMetricType) Decode(_ []byte, _ string, _ Source) ([][]string, error) { return nil, nil }
+func (*stubMetricType) ValueColumn(_ Source) string                             { return "value" }
+func (*stubMetricType) IsLabel(_ string, _ Source) bool                         { return true }
+func (t *stubMetricType) MetricName(_ []string, _ []string, _ Source) string    { return t.name }
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	cost, resource := &stubMetricType{name: "cost"}, &stubMetricType{name: "resource"}
+	if err := registry.Register("Cost", cost); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register("resource", resource); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		want    MetricType
+		wantErr bool
+	}{
+		{name: "cost", want: cost},
+		{name: "COST", want: cost},
+		{name: "resource", want: resource},
+		{name: "json", wantErr: true},
+		{name: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := registry.Get(tt.name)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Get(%q) expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Get(%q): %v", tt.name, err)
+		} else if got != tt.want {
+			t.Errorf("Get(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if err := registry.Register("COST", &stubMetricType{}); err == nil {
+		t.Error("registering a name twice expected an error")
+	}
+	if got, want := registry.Names(), []string{"cost", "resource"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,92 @@
+// Package opencost implements the opencost metric type, for the OpenCost and Kubecost allocation API.
+package opencost
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/config"
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes"
+)
+
+const Name = "opencost"
+
+type MetricType struct{}
+
+func New() *MetricType {
+	return &MetricType{}
+}
+
+// Decode maps OpenCost/Kubecost allocations to FOCUS-shaped records,
+// with one record for each of the cpu, ram and total cost of an allocation.
+func (*MetricType) Decode(byteData []byte, _ string, src metrictypes.Source) ([][]string, error) {
+	data := config.OpenCostAllocations{}
+	err := json.Unmarshal(byteData, &data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding allocations: %w", err)
+	}
+	if data.Code != 0 && data.Code != http.StatusOK {
+		return nil, fmt.Errorf("allocation API returned code %d: %s", data.Code, data.Message)
+	}
+
+	currency := src.Config.Spec.ExporterConfig.AdditionalVariables["BillingCurrency"]
+	if currency == "" {
+		currency = "USD"
+	}
+
+	records := [][]string{{"BilledCost", "BillingCurrency", "ChargePeriodStart", "ChargePeriodEnd", "ResourceId", "ResourceName", "ResourceType", "ServiceCategory", "ServiceName", "x_Cluster", "x_Node", "x_Namespace", "x_ControllerKind", "x_Controller", "x_Pod", "x_CostComponent"}}
+	for _, allocations := range data.Data {
+		for key, allocation := range allocations {
+			name := allocation.Name
+			if name == "" {
+				name = key
+			}
+			costs := map[string]float64{"cpu": allocation.CPUCost, "ram": allocation.RAMCost, "total": allocation.TotalCost}
+			for _, component := range []string{"cpu", "ram", "total"} {
+				records = append(records, []string{
+					strconv.FormatFloat(costs[component], 'f', -1, 64),
+					currency,
+					allocation.Start.Format(time.RFC3339),
+					allocation.End.Format(time.RFC3339),
+					name,
+					allocation.Properties.Pod,
+					"Allocation",
+					"Compute",
+					"Kubernetes",
+					allocation.Properties.Cluster,
+					allocation.Properties.Node,
+					allocation.Properties.Namespace,
+					allocation.Properties.ControllerKind,
+					allocation.Properties.Controller,
+					allocation.Properties.Pod,
+					component,
+				})
+			}
+		}
+	}
+
+	return records, nil
+}
+
+func (*MetricType) ValueColumn(_ metrictypes.Source) string {
+	return "BilledCost"
+}
+
+// IsLabel keeps the x_ columns, x_CostComponent tells the cpu, ram and total costs apart.
+func (*MetricType) IsLabel(_ string, _ metrictypes.Source) bool {
+	return true
+}
+
+// MetricName exports the total cost of the allocations as billed_cost, and their cpu and ram costs as
+// billed_cost_component, so that summing billed_cost does not count the allocations twice.
+func (*MetricType) MetricName(header []string, record []string, _ metrictypes.Source) string {
+	for i, column := range header {
+		if column == "x_CostComponent" && i < len(record) && record[i] != "total" {
+			return "billed_cost_component"
+		}
+	}
+	return "billed_cost"
+}
@@ -0,0 +1,113 @@
+package opencost
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter-generic/pkg/metrictypes"
+)
+
+const allocations = `{"code":200,"data":[{"team-a/api":{"name":"team-a/api","properties":{"cluster":"c1","namespace":"team-a","pod":"api-0"},` +
+	`"start":"2025-01-01T00:00:00Z","end":"2025-01-02T00:00:00Z","cpuCost":1,"ramCost":0.5,"totalCost":1.5}}]}`
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		currency   string
+		want       map[string]string
+		wantErr    bool
+		wantLength int
+	}{
+		{
+			name:       "allocation",
+			data:       allocations,
+			want:       map[string]string{"cpu": "1", "ram": "0.5", "total": "1.5"},
+			wantLength: 4,
+		},
+		{
+			name:       "currency",
+			data:       allocations,
+			currency:   "EUR",
+			want:       map[string]string{"cpu": "1", "ram": "0.5", "total": "1.5"},
+			wantLength: 4,
+		},
+		{
+			name:    "error code",
+			data:    `{"code":400,"message":"bad window"}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid json",
+			data:    `{"data":`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := metrictypes.Source{}
+			if tt.currency != "" {
+				src.Config.Spec.ExporterConfig.AdditionalVariables = map[string]string{"BillingCurrency": tt.currency}
+			}
+			records, err := New().Decode([]byte(tt.data), "application/json", src)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != tt.wantLength {
+				t.Fatalf("got %d records, want %d", len(records), tt.wantLength)
+			}
+
+			header := records[0]
+			cost, currency, component := slices.Index(header, "BilledCost"), slices.Index(header, "BillingCurrency"), slices.Index(header, "x_CostComponent")
+			wantCurrency := tt.currency
+			if wantCurrency == "" {
+				wantCurrency = "USD"
+			}
+			for _, record := range records[1:] {
+				if got, want := record[cost], tt.want[record[component]]; got != want {
+					t.Errorf("%s cost = %q, want %q", record[component], got, want)
+				}
+				if record[currency] != wantCurrency {
+					t.Errorf("currency = %q, want %q", record[currency], wantCurrency)
+				}
+			}
+		})
+	}
+}
+
+func TestColumns(t *testing.T) {
+	metricType := New()
+	if got := metricType.ValueColumn(metrictypes.Source{}); got != "BilledCost" {
+		t.Errorf("ValueColumn() = %q, want BilledCost", got)
+	}
+	for _, column := range []string{"ResourceId", "x_Namespace", "x_CostComponent"} {
+		if !metricType.IsLabel(column, metrictypes.Source{}) {
+			t.Errorf("IsLabel(%q) = false, want true", column)
+		}
+	}
+
+	header := []string{"BilledCost", "x_CostComponent"}
+	names := []struct {
+		record []string
+		want   string
+	}{
+		{record: []string{"1.5", "total"}, want: "billed_cost"},
+		{record: []string{"1", "cpu"}, want: "billed_cost_component"},
+		{record: []string{"0.5", "ram"}, want: "billed_cost_component"},
+	}
+	for _, tt := range names {
+		if got := metricType.MetricName(header, tt.record, metrictypes.Source{}); got != tt.want {
+			t.Errorf("MetricName(%v) = %q, want %q", tt.record, got, tt.want)
+		}
+	}
+	if got := metricType.MetricName([]string{"BilledCost"}, []string{"1"}, metrictypes.Source{}); got != "billed_cost" {
+		t.Errorf("MetricName() without the component = %q, want billed_cost", got)
+	}
+}